@@ -0,0 +1,358 @@
+package fsm
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// ProblemKind identifies the kind of a Problem found by Machine.Analyze.
+type ProblemKind int
+
+const (
+	// ProblemNoStart means the Machine has no start state.
+	ProblemNoStart ProblemKind = iota + 1
+	// ProblemIncompleteTransition means a transition has no from or to state.
+	ProblemIncompleteTransition
+	// ProblemDuplicateName means two different states share a name.
+	ProblemDuplicateName
+	// ProblemUnreachable means a state cannot be reached from the start state.
+	ProblemUnreachable
+	// ProblemUnreachableEnd means an end state cannot be reached from the start state.
+	ProblemUnreachableEnd
+	// ProblemDeadEnd means a state that is not an end state has no outgoing transitions.
+	ProblemDeadEnd
+	// ProblemDuplicateTransition means a state has more than one transition with the same
+	// event and description.
+	ProblemDuplicateTransition
+	// ProblemEndHasExits means an end state has outgoing transitions.
+	ProblemEndHasExits
+	// ProblemCycle means a group of states can transition back into itself.
+	ProblemCycle
+)
+
+// Severity is the severity of a Problem.
+type Severity int
+
+const (
+	// SeverityError marks problems that make a Machine invalid.
+	SeverityError Severity = iota + 1
+	// SeverityWarning marks problems that are reported by Analyze but accepted by Validate.
+	SeverityWarning
+)
+
+// Problem is a single finding of Machine.Analyze.
+type Problem struct {
+	Kind       ProblemKind // The kind of problem
+	Severity   Severity    // Whether the problem makes the Machine invalid
+	State      string      // Name of the state concerned, if any
+	Transition string      // Description of the transition concerned, if any
+	Message    string      // Human-readable description of the problem
+}
+
+// Report is the result of Machine.Analyze.
+type Report struct {
+	Problems []Problem // All problems found, errors and warnings
+}
+
+// Errors returns the problems of the report with SeverityError.
+func (r Report) Errors() []Problem {
+	return r.filter(SeverityError)
+}
+
+// Warnings returns the problems of the report with SeverityWarning.
+func (r Report) Warnings() []Problem {
+	return r.filter(SeverityWarning)
+}
+
+// Err returns a *ValidationError listing the errors of the report,
+// or nil if there are none.
+func (r Report) Err() error {
+	errs := r.Errors()
+	if len(errs) == 0 {
+		return nil
+	}
+	return &ValidationError{Problems: errs}
+}
+
+// filter returns the problems with the given severity.
+func (r Report) filter(s Severity) []Problem {
+	var out []Problem
+	for _, p := range r.Problems {
+		if p.Severity == s {
+			out = append(out, p)
+		}
+	}
+	return out
+}
+
+// ValidationError is returned by Machine.Validate and lists every problem
+// that makes the Machine invalid.
+type ValidationError struct {
+	Problems []Problem // The problems found, all with SeverityError
+}
+
+// Is reports whether target is ErrNoStartState and the Machine has no start state.
+func (e *ValidationError) Is(target error) bool {
+	if target != ErrNoStartState {
+		return false
+	}
+	for _, p := range e.Problems {
+		if p.Kind == ProblemNoStart {
+			return true
+		}
+	}
+	return false
+}
+
+// Error returns the messages of all problems.
+func (e *ValidationError) Error() string {
+	if len(e.Problems) == 1 {
+		return e.Problems[0].Message
+	}
+
+	msgs := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		msgs[i] = p.Message
+	}
+	return fmt.Sprintf("%d problems: %s", len(e.Problems), strings.Join(msgs, "; "))
+}
+
+// Analyze runs a structural analysis of the Machine and returns a Report
+// listing every problem found.
+//
+// The following are reported as errors, and cause Validate to fail:
+// - the Machine has no start state
+// - a transition has no from or to state
+// - two different states share a name
+// - a state or end state cannot be reached from the start state
+// - a state that is not an end state has no own or inherited outgoing transitions
+// - a state has more than one transition with the same event and description
+//
+// The following are reported as warnings:
+// - an end state has outgoing transitions
+// - a group of states forms a cycle
+//
+// Example:
+//
+//	for _, p := range m.Analyze().Warnings() {
+//	    log.Println(p.Message)
+//	}
+func (m *Machine) Analyze() Report {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	var r Report
+	add := func(kind ProblemKind, sev Severity, state, transition, format string, args ...interface{}) {
+		r.Problems = append(r.Problems, Problem{
+			Kind:       kind,
+			Severity:   sev,
+			State:      state,
+			Transition: transition,
+			Message:    fmt.Sprintf(format, args...),
+		})
+	}
+
+	start, _ := m.start.Load().(State)
+	if start == nil {
+		add(ProblemNoStart, SeverityError, "", "", "no start state set")
+	}
+
+	// complete transitions only, keyed by source state id
+	edges := make(map[uint64][]Transition, len(m.transitions))
+	for _, id := range m.transitionKeys() {
+		for _, t := range m.transitions[id] {
+			if t.From() == nil {
+				add(ProblemIncompleteTransition, SeverityError, "", t.Description(),
+					"transition '%s' has no from state", t.Description())
+				continue
+			}
+			if t.To() == nil {
+				add(ProblemIncompleteTransition, SeverityError, t.From().Name(), t.Description(),
+					"transition '%s' has no to state", t.Description())
+				continue
+			}
+			edges[id] = append(edges[id], t)
+		}
+	}
+
+	states := m.states()
+
+	names := make(map[string]uint64, len(states))
+	for _, s := range states {
+		if id, ok := names[s.Name()]; ok && id != s.Id() {
+			add(ProblemDuplicateName, SeverityError, s.Name(), "",
+				"invalid: all state names must be unique: '%s'", s.Name())
+			continue
+		}
+		names[s.Name()] = s.Id()
+	}
+
+	// resolved destinations of every state, including those inherited from
+	// parent states
+	adj := make(map[uint64][]State, len(states))
+	for _, s := range states {
+		for _, a := range ancestry(s) {
+			for _, t := range edges[a.Id()] {
+				adj[s.Id()] = append(adj[s.Id()], m.resolve(origin(t.To())))
+			}
+		}
+	}
+
+	if start != nil {
+		// entering a state also enters its parents
+		reachable := make(map[uint64]bool)
+		var queue []State
+		visit := func(s State) {
+			if reachable[s.Id()] {
+				return
+			}
+			for _, a := range ancestry(s) {
+				reachable[a.Id()] = true
+			}
+			queue = append(queue, s)
+		}
+
+		visit(m.resolve(start))
+		for len(queue) > 0 {
+			s := queue[0]
+			queue = queue[1:]
+			for _, to := range adj[s.Id()] {
+				visit(to)
+			}
+		}
+
+		for _, s := range states {
+			if reachable[s.Id()] {
+				continue
+			}
+			if _, ok := m.endStates[s.Id()]; ok {
+				add(ProblemUnreachableEnd, SeverityError, s.Name(), "",
+					"end state '%s' is not reachable from start state '%s'", s.Name(), start.Name())
+				continue
+			}
+			add(ProblemUnreachable, SeverityError, s.Name(), "",
+				"state '%s' is not reachable from start state '%s'", s.Name(), start.Name())
+		}
+	}
+
+	for _, s := range states {
+		_, end := m.endStates[s.Id()]
+		_, composite := m.initial[s.Id()]
+		out := edges[s.Id()]
+
+		if len(adj[s.Id()]) == 0 && !end && !composite {
+			add(ProblemDeadEnd, SeverityError, s.Name(), "",
+				"state '%s' has no outgoing transitions and is not an end state", s.Name())
+		}
+		if len(out) > 0 && end {
+			add(ProblemEndHasExits, SeverityWarning, s.Name(), "",
+				"end state '%s' has %d outgoing transitions", s.Name(), len(out))
+		}
+
+		seen := make(map[string]bool, len(out))
+		for _, t := range out {
+			key := label(t)
+			if seen[key] {
+				add(ProblemDuplicateTransition, SeverityError, s.Name(), t.Description(),
+					"state '%s' has more than one transition '%s'", s.Name(), key)
+			}
+			seen[key] = true
+		}
+	}
+
+	for _, cycle := range cycles(states, adj) {
+		members := make([]string, len(cycle))
+		for i, s := range cycle {
+			members[i] = s.Name()
+		}
+		add(ProblemCycle, SeverityWarning, members[0], "",
+			"states form a cycle: %s", strings.Join(members, ", "))
+	}
+
+	return r
+}
+
+// transitionKeys returns the keys of m.transitions in ascending order, so
+// that analysis results are deterministic. The caller must hold m.mu.
+func (m *Machine) transitionKeys() []uint64 {
+	keys := make([]uint64, 0, len(m.transitions))
+	for id := range m.transitions {
+		keys = append(keys, id)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		return keys[i] < keys[j]
+	})
+
+	return keys
+}
+
+// cycles returns the strongly connected components of the graph that contain
+// a cycle, using Tarjan's algorithm. States within a component, and the
+// components themselves, are ordered by id.
+func cycles(states []State, adj map[uint64][]State) [][]State {
+	var (
+		index   = make(map[uint64]int, len(states))
+		low     = make(map[uint64]int, len(states))
+		onStack = make(map[uint64]bool, len(states))
+		stack   []State
+		next    int
+		out     [][]State
+		visit   func(State)
+	)
+
+	visit = func(s State) {
+		id := s.Id()
+		index[id], low[id] = next, next
+		next++
+		stack = append(stack, s)
+		onStack[id] = true
+
+		selfLoop := false
+		for _, to := range adj[id] {
+			if to.Id() == id {
+				selfLoop = true
+			}
+			if _, ok := index[to.Id()]; !ok {
+				visit(to)
+				if low[to.Id()] < low[id] {
+					low[id] = low[to.Id()]
+				}
+			} else if onStack[to.Id()] && index[to.Id()] < low[id] {
+				low[id] = index[to.Id()]
+			}
+		}
+
+		if low[id] != index[id] {
+			return
+		}
+
+		var scc []State
+		for {
+			top := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[top.Id()] = false
+			scc = append(scc, top)
+			if top.Id() == id {
+				break
+			}
+		}
+		if len(scc) > 1 || selfLoop {
+			sort.Slice(scc, func(i, j int) bool {
+				return scc[i].Id() < scc[j].Id()
+			})
+			out = append(out, scc)
+		}
+	}
+
+	for _, s := range states {
+		if _, ok := index[s.Id()]; !ok {
+			visit(s)
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i][0].Id() < out[j][0].Id()
+	})
+
+	return out
+}
@@ -0,0 +1,118 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestAnalyze(t *testing.T) {
+	never := func(context.Context, interface{}) (bool, error) {
+		return false, nil
+	}
+
+	kinds := func(problems []Problem) []ProblemKind {
+		out := make([]ProblemKind, 0, len(problems))
+		for _, p := range problems {
+			out = append(out, p.Kind)
+		}
+		return out
+	}
+
+	t.Run("valid", func(t *testing.T) {
+		s1 := NewState("STATE1")
+		s2 := NewState("STATE2")
+		s3 := NewState("STATE3")
+		m := NewMachine(WithTransitions(
+			s1.When("a", never).Then(s2),
+			s2.When("b", never).Then(s3),
+		))
+		if err := m.SetEndStates("STATE3"); err != nil {
+			t.Fatal(err)
+		}
+
+		if r := m.Analyze(); len(r.Problems) != 0 {
+			t.Fatalf("unexpected problems: %+v", r.Problems)
+		}
+		if err := m.Validate(); err != nil {
+			t.Fatal(err)
+		}
+	})
+
+	t.Run("no start", func(t *testing.T) {
+		m := Machine{}
+		var verr *ValidationError
+		if err := m.Validate(); !errors.As(err, &verr) {
+			t.Fatalf("expected validation error, got %v", err)
+		}
+		if got := kinds(verr.Problems); !reflect.DeepEqual(got, []ProblemKind{ProblemNoStart}) {
+			t.Fatalf("unexpected problems: %v", got)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		s1 := NewState("STATE1")
+		s2 := NewState("STATE2")
+		s3 := NewState("STATE3")
+		s4 := NewState("STATE4")
+		s5 := NewState("STATE5")
+		m := NewMachine(WithTransitions(
+			s1.When("a", never).Then(s2),
+			s1.When("a", never).Then(s3),
+			s4.When("d", never).Then(s5),
+		))
+		if err := m.SetEndStates("STATE3", "STATE5"); err != nil {
+			t.Fatal(err)
+		}
+
+		var verr *ValidationError
+		if err := m.Validate(); !errors.As(err, &verr) {
+			t.Fatalf("expected validation error, got %v", err)
+		}
+
+		expected := []ProblemKind{
+			ProblemUnreachable,         // STATE4
+			ProblemUnreachableEnd,      // STATE5
+			ProblemDuplicateTransition, // STATE1 'a'
+			ProblemDeadEnd,             // STATE2
+		}
+		if got := kinds(verr.Problems); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected %v, got %v", expected, got)
+		}
+		if verr.Problems[0].State != "STATE4" || verr.Problems[2].Transition != "a" {
+			t.Fatalf("unexpected problems: %+v", verr.Problems)
+		}
+	})
+
+	t.Run("warnings", func(t *testing.T) {
+		s1 := NewState("STATE1")
+		s2 := NewState("STATE2")
+		s3 := NewState("STATE3")
+		m := NewMachine(WithTransitions(
+			s1.When("a", never).Then(s2),
+			s2.When("b", never).Then(s1),
+			s2.When("c", never).Then(s3),
+			s3.When("d", never).Then(s3),
+		))
+		if err := m.SetEndStates("STATE3"); err != nil {
+			t.Fatal(err)
+		}
+
+		if err := m.Validate(); err != nil {
+			t.Fatalf("warnings must not fail validation: %v", err)
+		}
+
+		r := m.Analyze()
+		expected := []ProblemKind{ProblemEndHasExits, ProblemCycle, ProblemCycle}
+		if got := kinds(r.Warnings()); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected %v, got %v", expected, got)
+		}
+		if msg := r.Warnings()[1].Message; msg != "states form a cycle: STATE1, STATE2" {
+			t.Fatalf("unexpected message: %s", msg)
+		}
+		if msg := r.Warnings()[2].Message; msg != "states form a cycle: STATE3" {
+			t.Fatalf("unexpected message: %s", msg)
+		}
+	})
+}
@@ -0,0 +1,349 @@
+package fsm
+
+import (
+	"fmt"
+	"time"
+)
+
+// idSpace generates IDs for the states and transitions of a single Definition,
+// independently of the package-wide counter used by NewState.
+type idSpace struct {
+	n uint64 // Last ID handed out
+}
+
+// next returns the next ID in the space.
+func (s *idSpace) next() uint64 {
+	s.n++
+	return s.n
+}
+
+// Builder defines states and transitions by name and produces an immutable
+// Definition. Every Builder has its own ID space: two Builders given the same
+// calls produce states and transitions with the same IDs, regardless of what
+// else the process has created. States must be declared with State before
+// Build; transitions refer to them by name.
+//
+// A Builder is not safe for concurrent use.
+//
+// Example:
+//
+//	b := fsm.NewBuilder()
+//	b.State("PENDING")
+//	b.State("PAID")
+//	b.State("CANCELLED")
+//	b.When("PENDING", "paid", isPaid).Then("PAID")
+//	b.On("PENDING", "cancel").Then("CANCELLED")
+//	b.End("PAID", "CANCELLED")
+//
+//	def, err := b.Build()
+//	if err != nil {
+//	    // handle error
+//	}
+//	m := def.New()
+type Builder struct {
+	ids         idSpace              // ID space of the definition
+	states      map[string]State     // Declared states by name
+	order       []State              // Declared states in declaration order
+	transitions []*BuilderTransition // Transitions in the order they were completed with Then
+	start       string               // Name of the start state, if set
+	end         []string             // Names of the end states
+	policy      ConflictPolicy       // How to choose between transitions whose guards pass
+	err         error                // First error found while declaring
+}
+
+// NewBuilder creates an empty Builder.
+func NewBuilder() *Builder {
+	return &Builder{states: make(map[string]State)}
+}
+
+// State declares a state with the given name and options and returns it, or
+// returns the state already declared with that name. Declaring a state again
+// with options is an error reported by Build. Parents given with WithParent
+// must be states returned by this Builder.
+//
+// Example:
+//
+//	processing := b.State("PROCESSING")
+//	b.State("VALIDATING", fsm.WithParent(processing), fsm.AsInitial())
+func (b *Builder) State(name string, opts ...StateOption) State {
+	if s, ok := b.states[name]; ok {
+		if len(opts) > 0 {
+			b.fail(fmt.Errorf("state '%s' is already declared", name))
+		}
+		return s
+	}
+
+	s := machineState{id: b.ids.next(), name: name}
+	for _, f := range opts {
+		s = f(s)
+	}
+	b.states[name] = s
+	b.order = append(b.order, s)
+
+	return s
+}
+
+// HistoryOf declares the shallow history pseudo-state of the named state (see
+// HistoryOf) and returns its name, for use as the destination of a transition.
+//
+// Example:
+//
+//	b.On("PAUSED", "resume").Then(b.HistoryOf("PROCESSING"))
+func (b *Builder) HistoryOf(parent string) string {
+	return b.history(parent, false)
+}
+
+// DeepHistoryOf declares the deep history pseudo-state of the named state (see
+// DeepHistoryOf) and returns its name, for use as the destination of a transition.
+func (b *Builder) DeepHistoryOf(parent string) string {
+	return b.history(parent, true)
+}
+
+// history declares a history pseudo-state of the named state.
+func (b *Builder) history(parent string, deep bool) string {
+	p, ok := b.states[parent]
+	if !ok {
+		b.fail(&UnknownStateError{Name: parent})
+		return ""
+	}
+
+	h := historyState{parent: p, deep: deep}
+	if s, ok := b.states[h.Name()]; ok {
+		return s.Name()
+	}
+	h.id = b.ids.next()
+	b.states[h.Name()] = h
+
+	return h.Name()
+}
+
+// When creates a transition from the named state with the specified condition.
+// The transition is added to the Builder when its destination is set with Then.
+// See State.When.
+func (b *Builder) When(from, desc string, f TriggerFunc) *BuilderTransition {
+	return b.transition(from, &edge{desc: desc, f: f})
+}
+
+// On creates a transition from the named state that fires on the specified
+// event. See State.On.
+func (b *Builder) On(from string, trigger Trigger) *BuilderTransition {
+	return b.transition(from, &edge{desc: string(trigger), trigger: trigger})
+}
+
+// After creates a transition from the named state that fires once the state
+// has been active for d. See State.After.
+// Panics if d is not positive.
+func (b *Builder) After(from string, d time.Duration) *BuilderTransition {
+	if d <= 0 {
+		panic("timeout must be positive")
+	}
+
+	return b.transition(from, &edge{desc: "after " + d.String(), timeout: d})
+}
+
+// transition wraps e in a BuilderTransition from the named state.
+func (b *Builder) transition(from string, e *edge) *BuilderTransition {
+	e.id = b.ids.next()
+	return &BuilderTransition{b: b, from: from, e: e}
+}
+
+// Start sets the start state by name. If it is not called, the source of the
+// first transition is the start state.
+func (b *Builder) Start(name string) *Builder {
+	b.start = name
+	return b
+}
+
+// End sets the end states by name. See Machine.SetEndStates.
+func (b *Builder) End(names ...string) *Builder {
+	b.end = append(b.end, names...)
+	return b
+}
+
+// Policy sets how machines and instances created from the Definition choose
+// between transitions whose guards pass. See WithConflictPolicy.
+func (b *Builder) Policy(p ConflictPolicy) *Builder {
+	b.policy = p
+	return b
+}
+
+// fail records err unless an error was already recorded.
+func (b *Builder) fail(err error) {
+	if b.err == nil {
+		b.err = err
+	}
+}
+
+// Build checks the declarations and returns a Definition. It returns the first
+// error found while declaring, an *UnknownStateError if a transition, the start
+// state or an end state refers to an undeclared state, or a *ValidationError
+// if the resulting machine does not pass Machine.Validate.
+// The Builder can be used again after Build; the Definition is not affected.
+func (b *Builder) Build() (*Definition, error) {
+	if b.err != nil {
+		return nil, b.err
+	}
+
+	def := &Definition{
+		states:      make(map[string]State, len(b.states)),
+		order:       append([]State(nil), b.order...),
+		transitions: make([]Transition, 0, len(b.transitions)),
+		start:       b.start,
+		end:         append([]string(nil), b.end...),
+		policy:      b.policy,
+	}
+	for name, s := range b.states {
+		def.states[name] = s
+	}
+
+	for _, bt := range b.transitions {
+		from, ok := b.states[bt.from]
+		if !ok {
+			return nil, &UnknownStateError{Name: bt.from}
+		}
+		to, ok := b.states[bt.to]
+		if !ok {
+			return nil, &UnknownStateError{Name: bt.to}
+		}
+
+		// copy the edge, so that the definition is not changed by later calls
+		// on the BuilderTransition
+		e := *bt.e
+		e.from, e.to = from, to
+		def.transitions = append(def.transitions, &e)
+	}
+
+	used := make(map[uint64]bool, len(def.order))
+	for _, t := range def.transitions {
+		for _, s := range []State{origin(t.From()), origin(t.To())} {
+			for ; s != nil; s = s.Parent() {
+				used[s.Id()] = true
+			}
+		}
+	}
+	for _, s := range def.order {
+		if p := s.Parent(); p != nil {
+			if known, ok := b.states[p.Name()]; !ok || known.Id() != p.Id() {
+				return nil, fmt.Errorf("parent of '%s': %w", s.Name(), &UnknownStateError{Name: p.Name()})
+			}
+		}
+		if !used[s.Id()] {
+			return nil, fmt.Errorf("state '%s' is not used by any transition", s.Name())
+		}
+	}
+
+	m, err := def.machine()
+	m.Stop()
+	if err != nil {
+		return nil, err
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+
+	// the machine is never changed again, and is shared by all instances
+	def.proto = m
+	def.initial = m.current()
+
+	return def, nil
+}
+
+// BuilderTransition is a transition of a Builder that is being defined.
+type BuilderTransition struct {
+	b    *Builder
+	from string // Name of the source state
+	to   string // Name of the destination state, set by Then
+	e    *edge
+}
+
+// Do sets the action run when the transition fires. See Transition.Do.
+func (bt *BuilderTransition) Do(f ActionFunc) *BuilderTransition {
+	bt.e.act = f
+	return bt
+}
+
+// Prioritize sets the priority of the transition. See Transition.Prioritize.
+func (bt *BuilderTransition) Prioritize(p int) *BuilderTransition {
+	bt.e.priority = p
+	return bt
+}
+
+// On keys the transition by the specified event. See Transition.On.
+func (bt *BuilderTransition) On(trigger Trigger) *BuilderTransition {
+	bt.e.trigger = trigger
+	return bt
+}
+
+// Then sets the destination of the transition by name and adds it to the
+// Builder. The names are resolved by Build.
+func (bt *BuilderTransition) Then(to string) {
+	bt.to = to
+	bt.b.transitions = append(bt.b.transitions, bt)
+	if bt.b.start == "" && len(bt.b.transitions) == 1 {
+		bt.b.start = bt.from
+	}
+}
+
+// Definition is an immutable description of a Machine produced by a Builder.
+// Any number of independent Machines can be created from it with New, and any
+// number of lightweight Instances with Instance; they share its states and
+// transitions, which must not be modified.
+type Definition struct {
+	states      map[string]State // States by name, including history pseudo-states
+	order       []State          // Declared states in declaration order
+	transitions []Transition     // Transitions in the order they were added
+	start       string           // Name of the start state
+	end         []string         // Names of the end states
+	policy      ConflictPolicy   // Conflict policy of machines and instances
+
+	proto   *Machine // Read-only machine holding the indexed transitions, shared by instances
+	initial State    // State instances start in
+}
+
+// New creates a Machine from the Definition, in its start state. The options
+// are applied after the transitions are added; they must not add transitions,
+// as the IDs of the Definition are only unique among themselves.
+//
+// Example:
+//
+//	m := def.New(fsm.WithHistory(10))
+//	changed, err := m.Update(ctx, order)
+func (d *Definition) New(opts ...Option) *Machine {
+	// the start and end states were checked by Build
+	m, _ := d.machine(opts...)
+	return m
+}
+
+// machine creates a Machine from the Definition, returning an error if the
+// start or end states are not known to it.
+func (d *Definition) machine(opts ...Option) (*Machine, error) {
+	m := NewMachine(append([]Option{WithTransitions(d.transitions...), WithConflictPolicy(d.policy)}, opts...)...)
+
+	if d.start != "" {
+		if err := m.SetStart(d.start); err != nil {
+			return m, err
+		}
+	}
+	if len(d.end) > 0 {
+		if err := m.SetEndStates(d.end...); err != nil {
+			return m, err
+		}
+	}
+
+	return m, nil
+}
+
+// State returns the declared state with the given name, or nil.
+func (d *Definition) State(name string) State {
+	return d.states[name]
+}
+
+// States returns the declared states in the order they were declared.
+func (d *Definition) States() []State {
+	return append([]State(nil), d.order...)
+}
+
+// Transitions returns the transitions in the order they were added.
+func (d *Definition) Transitions() []Transition {
+	return append([]Transition(nil), d.transitions...)
+}
@@ -0,0 +1,227 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestBuilder(t *testing.T) {
+	isPaid := func(_ context.Context, v interface{}) (bool, error) {
+		return v == "paid", nil
+	}
+
+	mkBuilder := func() *Builder {
+		b := NewBuilder()
+		b.State("PENDING")
+		b.State("PAID")
+		b.State("CANCELLED")
+		b.When("PENDING", "paid", isPaid).Then("PAID")
+		b.On("PENDING", "cancel").Then("CANCELLED")
+		b.End("PAID", "CANCELLED")
+		return b
+	}
+	ids := func(def *Definition) []uint64 {
+		var out []uint64
+		for _, s := range def.States() {
+			out = append(out, s.Id())
+		}
+		for _, tr := range def.Transitions() {
+			out = append(out, tr.Id())
+		}
+		return out
+	}
+
+	t.Run("identity", func(t *testing.T) {
+		first, err := mkBuilder().Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		NewState("UNRELATED")
+		second, err := mkBuilder().Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		want := []uint64{1, 2, 3, 4, 5}
+		if got := ids(first); !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+		if got := ids(second); !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+		if first.State("PAID").Id() != 2 || first.State("MISSING") != nil {
+			t.Fatal("unexpected state lookup")
+		}
+	})
+
+	t.Run("instances", func(t *testing.T) {
+		def, err := mkBuilder().Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m1, m2 := def.New(), def.New(WithHistory(5))
+
+		if _, err := m1.Update(context.Background(), "paid"); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m2.Fire(context.Background(), "cancel", nil); err != nil {
+			t.Fatal(err)
+		}
+		if m1.Current().Name() != "PAID" || m2.Current().Name() != "CANCELLED" {
+			t.Fatalf("expected independent machines, got %s and %s", m1.Current().Name(), m2.Current().Name())
+		}
+		if !m1.IsEndState() || !m2.IsEndState() || len(m2.History()) != 1 {
+			t.Fatal("expected end states and options to be applied")
+		}
+	})
+
+	t.Run("immutable", func(t *testing.T) {
+		b := NewBuilder()
+		b.State("A")
+		b.State("B")
+		tr := b.On("A", "go")
+		tr.Then("B")
+		b.End("B")
+		def, err := b.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		tr.Do(func(context.Context, interface{}) error { return errors.New("changed") })
+		b.State("C")
+		b.On("B", "go").Then("C")
+
+		m := def.New()
+		if _, err := m.Fire(context.Background(), "go", nil); err != nil {
+			t.Fatalf("expected definition to be unchanged, got %v", err)
+		}
+		if len(def.Transitions()) != 1 || def.State("C") != nil {
+			t.Fatal("expected definition to be unchanged")
+		}
+	})
+
+	t.Run("hierarchy and history", func(t *testing.T) {
+		b := NewBuilder()
+		processing := b.State("PROCESSING")
+		b.State("VALIDATING", WithParent(processing), AsInitial())
+		b.State("CHARGING", WithParent(processing))
+		b.State("PAUSED")
+		b.On("VALIDATING", "next").Then("CHARGING")
+		b.On("PROCESSING", "pause").Then("PAUSED")
+		b.On("PAUSED", "resume").Then(b.HistoryOf("PROCESSING"))
+		b.Start("PROCESSING")
+
+		def, err := b.Build()
+		if err != nil {
+			t.Fatal(err)
+		}
+		m := def.New()
+		for _, trigger := range []Trigger{"next", "pause", "resume"} {
+			if _, err := m.Fire(context.Background(), trigger, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if m.Current().Name() != "CHARGING" {
+			t.Fatalf("expected CHARGING, got %s", m.Current().Name())
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			build   func(b *Builder)
+			wantErr string
+			unknown string
+		}{
+			{
+				name: "unknown from",
+				build: func(b *Builder) {
+					b.State("B")
+					b.On("A", "go").Then("B")
+				},
+				wantErr: "unknown state: 'A'",
+				unknown: "A",
+			},
+			{
+				name: "unknown to",
+				build: func(b *Builder) {
+					b.State("A")
+					b.On("A", "go").Then("B")
+				},
+				wantErr: "unknown state: 'B'",
+				unknown: "B",
+			},
+			{
+				name: "unknown end",
+				build: func(b *Builder) {
+					b.State("A")
+					b.State("B")
+					b.On("A", "go").Then("B")
+					b.End("C")
+				},
+				wantErr: "unknown state: 'C'",
+				unknown: "C",
+			},
+			{
+				name: "unknown history",
+				build: func(b *Builder) {
+					b.State("A")
+					b.On("A", "go").Then(b.HistoryOf("P"))
+				},
+				wantErr: "unknown state: 'P'",
+				unknown: "P",
+			},
+			{
+				name: "foreign parent",
+				build: func(b *Builder) {
+					b.State("A", WithParent(NewState("P")))
+					b.State("B")
+					b.On("A", "go").Then("B")
+				},
+				wantErr: "parent of 'A': unknown state: 'P'",
+				unknown: "P",
+			},
+			{
+				name: "redeclared",
+				build: func(b *Builder) {
+					b.State("A")
+					b.State("A", AsInitial())
+				},
+				wantErr: "state 'A' is already declared",
+			},
+			{
+				name: "unused",
+				build: func(b *Builder) {
+					b.State("A")
+					b.State("B")
+					b.State("C")
+					b.On("A", "go").Then("B")
+				},
+				wantErr: "state 'C' is not used by any transition",
+			},
+			{
+				name:    "empty",
+				build:   func(*Builder) {},
+				wantErr: "no start state set",
+			},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				b := NewBuilder()
+				tt.build(b)
+				def, err := b.Build()
+				if def != nil || err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error %q, got %v", tt.wantErr, err)
+				}
+
+				var uerr *UnknownStateError
+				if tt.unknown != "" && (!errors.As(err, &uerr) || uerr.Name != tt.unknown) {
+					t.Fatalf("expected *UnknownStateError for %s, got %v", tt.unknown, err)
+				}
+			})
+		}
+	})
+}
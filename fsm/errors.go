@@ -0,0 +1,90 @@
+package fsm
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Sentinel errors returned by the package. They can be matched with errors.Is,
+// including when they are wrapped or carried by one of the error types below.
+var (
+	// ErrNoStartState is returned when a Machine without a start state is
+	// updated or reset.
+	ErrNoStartState = errors.New("machine has no start state")
+	// ErrTerminalState is returned when a completed Machine is updated (see
+	// WithTerminalEndStates).
+	ErrTerminalState = errors.New("machine is in a terminal state")
+	// ErrUnknownState is matched by every *UnknownStateError.
+	ErrUnknownState = errors.New("unknown state")
+	// ErrAmbiguousTransition is matched by every *AmbiguousTransitionError.
+	ErrAmbiguousTransition = errors.New("ambiguous transition")
+	// ErrUnsupportedSnapshot is returned by Restore for a snapshot with an
+	// unsupported version.
+	ErrUnsupportedSnapshot = errors.New("unsupported snapshot version")
+	// ErrQueueFull is returned by Send when the event queue is full and the
+	// Machine was created with OverflowError.
+	ErrQueueFull = errors.New("event queue is full")
+)
+
+// UnknownStateError is returned when a state is referred to by a name that
+// the Machine does not know.
+type UnknownStateError struct {
+	Name string // The name that was not found
+}
+
+// Error returns a message naming the unknown state.
+func (e *UnknownStateError) Error() string {
+	return fmt.Sprintf("unknown state: '%s'", e.Name)
+}
+
+// Is reports whether target is ErrUnknownState.
+func (e *UnknownStateError) Is(target error) bool {
+	return target == ErrUnknownState
+}
+
+// GuardError is returned by Update, Fire and their dry-run counterparts when
+// the guard of a transition fails. It wraps the error returned by the TriggerFunc.
+//
+// Example:
+//
+//	var gerr *fsm.GuardError
+//	if errors.As(err, &gerr) {
+//	    log.Printf("guard %q of transition %d failed: %v", gerr.Description, gerr.TransitionID, gerr.Err)
+//	}
+type GuardError struct {
+	TransitionID uint64 // Id of the transition whose guard failed
+	Description  string // Description of the transition whose guard failed
+	Err          error  // Error returned by the guard
+}
+
+// Error returns a message naming the transition and the guard's error.
+func (e *GuardError) Error() string {
+	return fmt.Sprintf("guard '%s' failed: %v", e.Description, e.Err)
+}
+
+// Unwrap returns the error returned by the guard.
+func (e *GuardError) Unwrap() error {
+	return e.Err
+}
+
+// AmbiguousTransitionError is returned in Strict mode when more than one
+// transition from a state could fire.
+type AmbiguousTransitionError struct {
+	State       string       // Name of the state the transitions leave
+	Transitions []Transition // Transitions whose guards passed, in the order they were added
+}
+
+// Error returns a message listing the competing transitions.
+func (e *AmbiguousTransitionError) Error() string {
+	descs := make([]string, len(e.Transitions))
+	for i, t := range e.Transitions {
+		descs[i] = fmt.Sprintf("'%s'", label(t))
+	}
+	return fmt.Sprintf("ambiguous transition from state '%s': %s", e.State, strings.Join(descs, ", "))
+}
+
+// Is reports whether target is ErrAmbiguousTransition.
+func (e *AmbiguousTransitionError) Is(target error) bool {
+	return target == ErrAmbiguousTransition
+}
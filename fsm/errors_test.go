@@ -0,0 +1,82 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestErrors(t *testing.T) {
+	errBoom := errors.New("boom")
+	failing := func(context.Context, interface{}) (bool, error) { return false, errBoom }
+
+	t.Run("guard error", func(t *testing.T) {
+		a, b := NewState("A"), NewState("B")
+		update := a.When("update guard", failing).Then(b)
+		fire := a.When("fire guard", failing).On("go").Then(b)
+		m := NewMachine(WithTransitions(update, fire))
+
+		_, err := m.Update(context.Background(), nil)
+		var gerr *GuardError
+		if !errors.As(err, &gerr) {
+			t.Fatalf("expected *GuardError, got %T", err)
+		}
+		if gerr.TransitionID != update.Id() || gerr.Description != "update guard" || !errors.Is(err, errBoom) {
+			t.Fatalf("unexpected error: %+v", gerr)
+		}
+		if err.Error() != "guard 'update guard' failed: boom" {
+			t.Fatalf("unexpected message: %s", err.Error())
+		}
+
+		_, err = m.Fire(context.Background(), "go", nil)
+		if !errors.As(err, &gerr) || gerr.TransitionID != fire.Id() || !errors.Is(err, errBoom) {
+			t.Fatalf("expected *GuardError for fired transition, got %v", err)
+		}
+
+		if _, err := m.Evaluate(context.Background(), nil); !errors.As(err, &gerr) {
+			t.Fatalf("expected *GuardError from Evaluate, got %v", err)
+		}
+	})
+
+	t.Run("unknown state", func(t *testing.T) {
+		m := NewMachine(WithTransitions(NewState("A").When("x", failing).Then(NewState("B"))))
+
+		for name, err := range map[string]error{
+			"SetStart":     m.SetStart("C"),
+			"SetEndStates": m.SetEndStates("B", "C"),
+		} {
+			var uerr *UnknownStateError
+			if !errors.As(err, &uerr) || uerr.Name != "C" || !errors.Is(err, ErrUnknownState) {
+				t.Fatalf("%s: expected *UnknownStateError, got %v", name, err)
+			}
+		}
+
+		snap := m.Snapshot()
+		snap.Current = "C"
+		if err := m.Restore(snap); !errors.Is(err, ErrUnknownState) {
+			t.Fatalf("expected ErrUnknownState from Restore, got %v", err)
+		}
+	})
+
+	t.Run("no start state", func(t *testing.T) {
+		m := &Machine{}
+		if _, err := m.Update(context.Background(), nil); !errors.Is(err, ErrNoStartState) {
+			t.Fatalf("expected ErrNoStartState from Update, got %v", err)
+		}
+		if err := m.Reset(); !errors.Is(err, ErrNoStartState) {
+			t.Fatalf("expected ErrNoStartState from Reset, got %v", err)
+		}
+		if err := m.Validate(); !errors.Is(err, ErrNoStartState) {
+			t.Fatalf("expected ErrNoStartState from Validate, got %v", err)
+		}
+	})
+
+	t.Run("unsupported snapshot", func(t *testing.T) {
+		m := NewMachine(WithTransitions(NewState("A").When("x", failing).Then(NewState("B"))))
+		snap := m.Snapshot()
+		snap.Version = SnapshotVersion + 1
+		if err := m.Restore(snap); !errors.Is(err, ErrUnsupportedSnapshot) {
+			t.Fatalf("expected ErrUnsupportedSnapshot, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,38 @@
+package fsm
+
+import (
+	"context"
+)
+
+// Fire updates the Machine state in response to a named event.
+// Only the transitions from the current state keyed by trigger (see State.On
+// and Transition.On) are considered; they are looked up directly rather than
+// by evaluating every guard of the current state. If a keyed transition has a
+// guard, it is evaluated with the payload, and the first transition whose guard
+// passes (or that has no guard) fires, unless another ConflictPolicy is set.
+// As with Update, transitions of the parent states are considered if none of
+// the current state fires. Hooks and actions are run as for Update.
+//
+// Returns:
+// - bool: true if the state changed, false otherwise
+// - error: any error that occurred during the update
+//
+// Example:
+//
+//	pending.On("cancel").Then(cancelled)
+//	pending.When("amount > 0", hasAmount).On("pay").Then(paid)
+//
+//	changed, err := Machine.Fire(ctx, "pay", payment)
+func (m *Machine) Fire(ctx context.Context, trigger Trigger, payload interface{}) (bool, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	curr, err := m.active(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return m.step(ctx, payload, curr, func(s State) []Transition {
+		return m.events[s.Id()][trigger]
+	})
+}
@@ -0,0 +1,138 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestFire(t *testing.T) {
+	pending := NewState("PENDING")
+	paid := NewState("PAID")
+	cancelled := NewState("CANCELLED")
+	review := NewState("REVIEW")
+
+	var guarded int
+	hasAmount := func(_ context.Context, v interface{}) (bool, error) {
+		guarded++
+		n, ok := v.(int)
+		if !ok {
+			return false, errors.New("amount expected")
+		}
+		return n > 0 && n < 1000, nil
+	}
+	isLarge := func(_ context.Context, v interface{}) (bool, error) {
+		n, _ := v.(int)
+		return n >= 1000, nil
+	}
+
+	mkMachine := func() *Machine {
+		guarded = 0
+		return NewMachine(WithTransitions(
+			pending.When("amount > 0", hasAmount).On("pay").Then(paid),
+			pending.When("amount >= 1000", isLarge).On("pay").Then(review),
+			pending.On("cancel").Then(cancelled),
+			pending.When("always", func(context.Context, interface{}) (bool, error) {
+				return true, nil
+			}).Then(cancelled),
+			review.On("approve").Then(paid),
+		))
+	}
+
+	t.Run("unguarded", func(t *testing.T) {
+		m := mkMachine()
+		changed, err := m.Fire(context.Background(), "cancel", nil)
+		if err != nil || !changed {
+			t.Fatalf("unexpected result: %v, %v", changed, err)
+		}
+		if m.Current().Id() != cancelled.Id() {
+			t.Fatal("expected CANCELLED")
+		}
+		if guarded != 0 {
+			t.Fatal("unexpected guard evaluation")
+		}
+	})
+
+	t.Run("guarded", func(t *testing.T) {
+		m := mkMachine()
+		ctx := context.Background()
+
+		if changed, err := m.Fire(ctx, "pay", 0); changed || err != nil {
+			t.Fatalf("unexpected result: %v, %v", changed, err)
+		}
+		if changed, err := m.Fire(ctx, "pay", 5000); !changed || err != nil {
+			t.Fatalf("unexpected result: %v, %v", changed, err)
+		}
+		if m.Current().Id() != review.Id() {
+			t.Fatal("expected REVIEW")
+		}
+		if changed, err := m.Fire(ctx, "approve", nil); !changed || err != nil {
+			t.Fatalf("unexpected result: %v, %v", changed, err)
+		}
+		if m.Current().Id() != paid.Id() {
+			t.Fatal("expected PAID")
+		}
+	})
+
+	t.Run("guard error", func(t *testing.T) {
+		m := mkMachine()
+		if _, err := m.Fire(context.Background(), "pay", "lots"); err == nil {
+			t.Fatal("expected error")
+		}
+		if m.Current().Id() != pending.Id() {
+			t.Fatal("expected PENDING")
+		}
+	})
+
+	t.Run("unknown event", func(t *testing.T) {
+		m := mkMachine()
+		if changed, err := m.Fire(context.Background(), "approve", nil); changed || err != nil {
+			t.Fatalf("unexpected result: %v, %v", changed, err)
+		}
+		if guarded != 0 {
+			t.Fatal("unexpected guard evaluation")
+		}
+	})
+
+	t.Run("update ignores keyed transitions", func(t *testing.T) {
+		m := mkMachine()
+		if changed, err := m.Update(context.Background(), 5); !changed || err != nil {
+			t.Fatalf("unexpected result: %v, %v", changed, err)
+		}
+		if m.Current().Id() != cancelled.Id() {
+			t.Fatal("expected CANCELLED via the unkeyed transition")
+		}
+		if guarded != 0 {
+			t.Fatal("unexpected guard evaluation")
+		}
+	})
+
+	t.Run("history and hooks", func(t *testing.T) {
+		var entered bool
+		m := mkMachine()
+		WithHistory(1)(m)
+		WithOnEnter("CANCELLED", func(context.Context, interface{}, State, State, Transition) error {
+			entered = true
+			return nil
+		})(m)
+
+		if _, err := m.Fire(context.Background(), "cancel", nil); err != nil {
+			t.Fatal(err)
+		}
+		if !entered {
+			t.Fatal("expected enter hook")
+		}
+		if h := m.History(); len(h) != 1 || h[0].Trigger != "cancel" {
+			t.Fatalf("unexpected history: %+v", h)
+		}
+	})
+
+	t.Run("context", func(t *testing.T) {
+		m := mkMachine()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := m.Fire(ctx, "cancel", nil); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context error, got %v", err)
+		}
+	})
+}
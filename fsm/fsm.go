@@ -24,8 +24,7 @@ package fsm
 
 import (
 	"context"
-	"errors"
-	"fmt"
+	"sort"
 	"sync"
 	"sync/atomic"
 
@@ -42,7 +41,36 @@ type Machine struct {
 	endStates   map[uint64]State        // Map of end state IDs to states
 	idx         uint32                  // Index counter
 	transitions map[uint64][]Transition // Map of state IDs to transitions
-	cancel      func()                  // Cancellation function
+	cancel      func()                  // Cancellation function, stops all timers
+	ctx         context.Context         // Context of the timers, cancelled by cancel
+
+	events  map[uint64]map[Trigger][]Transition // Map of state IDs to transitions keyed by event
+	initial map[uint64]State                    // Map of state IDs to their initial sub-states
+	shallow map[uint64]State                    // Map of state IDs to the child active when last exited
+	deep    map[uint64]State                    // Map of state IDs to the innermost state active when last exited
+
+	onEnter      map[string][]HookFunc // Hooks run after entering a state, keyed by state name
+	onExit       map[string][]HookFunc // Hooks run before leaving a state, keyed by state name
+	onTransition []HookFunc            // Hooks run for every transition
+
+	history *historyRing  // Recent transitions, if enabled
+	sinks   []HistorySink // Receivers of every recorded transition
+
+	clock   Clock             // Source of time for history and timers
+	timers  map[uint64]*armed // Map of active state IDs to the timers started on entry
+	onError func(error)       // Receiver of errors from timed transitions and the run loop
+	policy  ConflictPolicy    // How to choose between transitions whose guards pass
+
+	qmu      sync.Mutex     // Mutex for the event queue, separate so Send never waits for a transition
+	inbox    chan queued    // Events sent from outside the run loop
+	internal []queued       // Events sent from within the run loop
+	overflow OverflowPolicy // What Send does when inbox is full
+	loop     *runLoop       // Run loop started by the last call to Run, if any
+
+	terminal   bool          // Whether entering an end state completes the Machine
+	completed  bool          // Whether the Machine has completed
+	done       chan struct{} // Closed when the Machine completes, created on demand
+	onComplete []HookFunc    // Hooks run when the Machine completes
 }
 
 // Option is a function type used to configure a Machine.
@@ -74,8 +102,7 @@ func WithTransitions(transitions ...Transition) Option {
 		}
 
 		for _, t := range transitions {
-			id := t.From().Id()
-			m.transitions[id] = append(m.transitions[id], t)
+			m.add(t)
 		}
 	}
 }
@@ -87,26 +114,23 @@ func WithTransitions(transitions ...Transition) Option {
 //
 //	Machine := fsm.NewMachine(fsm.WithTransitions(t1, t2))
 func NewMachine(opts ...Option) *Machine {
-	m := Machine{}
+	m := Machine{clock: realClock{}}
 	for _, f := range opts {
 		f(&m)
 	}
 
+	m.mu.Lock()
+	m.ctx, m.cancel = context.WithCancel(context.Background())
+	m.rearm()
+	m.mu.Unlock()
+
 	return &m
 }
 
-// Graph generates a visual representation of the state Machine.
-// This is a placeholder for future implementation.
-//func (m *Machine) Graph() {
-//	m.mu.RLock()
-//	defer m.mu.RUnlock()
-//
-//	// TODO: traverse the fsm and generate graph
-//}
-
 // SetStart sets the start state of the Machine by name.
 // It returns an error if no state with the given name is found.
-// The start state is also set as the current state.
+// The start state is also set as the current state; if it has an initial
+// sub-state (see AsInitial), that sub-state becomes the current state.
 //
 // Example:
 //
@@ -130,17 +154,21 @@ func (m *Machine) SetStart(name string) error {
 	}
 
 	if start == nil {
-		return fmt.Errorf("no state found with name: %s", name)
+		return &UnknownStateError{Name: name}
 	}
 
 	m.start.Store(start)
-	m.curr.Store(start)
+	m.curr.Store(m.resolve(start))
+	m.setCompleted(false)
+	m.rearm()
 
 	return nil
 }
 
 // Reset resets the Machine to its start state.
 // It returns an error if the Machine has no start state.
+// A completed Machine (see WithTerminalEndStates) can be updated again.
+// Any configuration remembered for history pseudo-states (see HistoryOf) is forgotten.
 //
 // Example:
 //
@@ -153,17 +181,21 @@ func (m *Machine) Reset() error {
 
 	starti := m.start.Load()
 	if starti == nil {
-		return errors.New("this machine has no start state")
+		return ErrNoStartState
 	}
 	start, _ := starti.(State)
-	m.curr.Store(start)
+	m.shallow, m.deep = nil, nil
+	m.curr.Store(m.resolve(start))
+	m.setCompleted(false)
+	m.rearm()
 
 	return nil
 }
 
 // SetEndStates sets the end states of the Machine by name.
 // It returns an error if any of the specified state names are not found.
-// End states are used to determine when the Machine has reached a terminal state.
+// End states are used to determine when the Machine has reached a terminal state;
+// with WithTerminalEndStates, entering one completes the Machine.
 //
 // Example:
 //
@@ -196,7 +228,7 @@ func (m *Machine) SetEndStates(names ...string) error {
 	})
 
 	if !ok {
-		return fmt.Errorf("invalid state: '%s'", names[idx])
+		return &UnknownStateError{Name: names[idx]}
 	}
 
 	return nil
@@ -219,7 +251,10 @@ func (m *Machine) IsEndState() bool {
 		return false
 	}
 
-	curr, _ := m.curr.Load().(State)
+	curr := m.current()
+	if curr == nil {
+		return false
+	}
 	_, ok := m.endStates[curr.Id()]
 
 	return ok
@@ -243,21 +278,51 @@ func (m *Machine) AddTransition(t Transition) {
 	}
 
 	if m.transitions == nil {
-		m.transitions = make(map[uint64][]Transition)
 		m.start.Store(from)
 	}
 
-	id := from.Id()
+	m.add(t)
+}
+
+// add indexes the transition by its from state and, if it is keyed by an
+// event, by that event. The caller must hold m.mu.
+func (m *Machine) add(t Transition) {
+	if m.transitions == nil {
+		m.transitions = make(map[uint64][]Transition)
+	}
+
+	id := t.From().Id()
 	m.transitions[id] = append(m.transitions[id], t)
+	m.index(t.From())
+	m.index(t.To())
+
+	// a timed transition added to an active state starts right away
+	if m.isActive(t.From()) {
+		m.startTimer(t.From(), t)
+	}
+
+	if trigger := t.Trigger(); trigger != "" {
+		if m.events == nil {
+			m.events = make(map[uint64]map[Trigger][]Transition)
+		}
+		if m.events[id] == nil {
+			m.events[id] = make(map[Trigger][]Transition)
+		}
+		m.events[id][trigger] = append(m.events[id][trigger], t)
+	}
 }
 
 // Validate validates the Machine configuration.
-// It checks that:
+// It runs Analyze and checks that:
 // - The Machine has a start state
 // - All transitions have from and to states
 // - All state names are unique
+// - All states and end states are reachable from the start state
+// - All states without outgoing transitions are end states
+// - No state has two transitions with the same event and description
 //
-// Returns an error if any of these conditions are not met.
+// Returns a *ValidationError listing every problem found if any of these
+// conditions are not met. Warnings reported by Analyze are ignored.
 //
 // Example:
 //
@@ -265,37 +330,7 @@ func (m *Machine) AddTransition(t Transition) {
 //	    // handle error
 //	}
 func (m *Machine) Validate() error {
-	m.mu.RLock()
-	defer m.mu.RUnlock()
-
-	sm := make(map[uint64]State)
-
-	start, _ := m.start.Load().(State)
-	if start == nil {
-		return errors.New("no start state set")
-	}
-	var stateNames []string
-	for _, tt := range m.transitions {
-		for _, t := range tt {
-			if t.From() == nil {
-				return fmt.Errorf("transition '%s' has no from state", t.Description())
-			}
-			if t.To() == nil {
-				return fmt.Errorf("transition '%s' has no to state", t.Description())
-			}
-			sm[t.From().Id()] = t.From()
-			sm[t.To().Id()] = t.To()
-			stateNames = append(stateNames, t.From().Name(), t.To().Name())
-		}
-	}
-
-	stateNames = slice.String(stateNames).Unique()
-
-	if len(stateNames) != len(sm) {
-		return errors.New("invalid: all state names must be unique")
-	}
-
-	return nil
+	return m.Analyze().Err()
 }
 
 // Current returns the current state of the Machine.
@@ -309,22 +344,74 @@ func (m *Machine) Current() State {
 	m.mu.RLock()
 	defer m.mu.RUnlock()
 
+	return m.current()
+}
+
+// current returns the current state, falling back to the start state (or its
+// initial sub-state) if the Machine has not moved yet. The caller must hold m.mu.
+func (m *Machine) current() State {
 	curr, _ := m.curr.Load().(State)
 	if curr == nil {
-		curr, _ = m.start.Load().(State)
+		start, _ := m.start.Load().(State)
+		curr = m.resolve(start)
 	}
 	return curr
 }
 
+// lookup returns the state with the given name, or nil if no such state is
+// known to the Machine (see states). The caller must hold m.mu.
+func (m *Machine) lookup(name string) State {
+	for _, s := range m.states() {
+		if s.Name() == name {
+			return s
+		}
+	}
+
+	return nil
+}
+
+// states returns every state that a transition of the Machine starts or ends
+// in, along with their ancestors, ordered by id. History pseudo-states are
+// replaced by their parent. The caller must hold m.mu.
+func (m *Machine) states() []State {
+	seen := make(map[uint64]bool)
+	var out []State
+	add := func(s State) {
+		for s = origin(s); s != nil && !seen[s.Id()]; s = s.Parent() {
+			seen[s.Id()] = true
+			out = append(out, s)
+		}
+	}
+	for _, tt := range m.transitions {
+		for _, t := range tt {
+			add(t.From())
+			add(t.To())
+		}
+	}
+	sort.Slice(out, func(i, j int) bool {
+		return out[i].Id() < out[j].Id()
+	})
+
+	return out
+}
+
 // Update updates the Machine state based on the provided value.
-// It evaluates all transitions from the current state and transitions to the first one
-// whose condition evaluates to true.
+// It evaluates all transitions from the current state that are not keyed by an
+// event (see Fire) and transitions to the first one whose condition evaluates to
+// true (see WithConflictPolicy for other ways to choose). If none does, the
+// transitions of the parent state are evaluated, and so on up to the top-level
+// state. Lifecycle hooks registered with WithOnExit,
+// WithOnTransition and WithOnEnter are run around the change; see HookFunc for
+// their ordering and error semantics. If the transition has an action (see
+// Transition.Do), it runs after the exit and transition hooks; when it fails
+// the state is left unchanged and its error is returned.
 //
 // Returns:
 // - bool: true if the state changed, false otherwise
 // - error: any error that occurred during the update
 //
-// The update respects context cancellation.
+// The update respects context cancellation. Once the Machine has completed
+// (see WithTerminalEndStates), ErrTerminalState is returned.
 //
 // Example:
 //
@@ -339,39 +426,100 @@ func (m *Machine) Update(ctx context.Context, value interface{}) (bool, error) {
 	m.mu.Lock()
 	defer m.mu.Unlock()
 
+	curr, err := m.active(ctx)
+	if err != nil {
+		return false, err
+	}
+
+	return m.step(ctx, value, curr, m.unkeyed)
+}
+
+// unkeyed returns the transitions from s that are considered by Update.
+// The caller must hold m.mu.
+func (m *Machine) unkeyed(s State) []Transition {
+	var out []Transition
+	for _, t := range m.transitions[s.Id()] {
+		if t.Trigger() == "" && t.Timeout() <= 0 {
+			out = append(out, t)
+		}
+	}
+	return out
+}
+
+// active checks ctx and returns the current state, falling back to the start
+// state. It fails if the Machine has completed. The caller must hold m.mu.
+func (m *Machine) active(ctx context.Context) (State, error) {
 	select {
 	case <-ctx.Done():
-		return false, ctx.Err()
+		return nil, ctx.Err()
 	default:
 	}
 
-	curr, _ := m.curr.Load().(State)
+	if m.completed {
+		return nil, ErrTerminalState
+	}
+
+	curr := m.current()
 	if curr == nil {
-		curr, _ = m.start.Load().(State)
-		if curr == nil {
-			return false, errors.New("machine has no start state")
-		}
+		return nil, ErrNoStartState
 	}
-	transitions, ok := m.transitions[curr.Id()]
-	if !ok {
-		return false, nil
+
+	return curr, nil
+}
+
+// commit moves the Machine from curr to the destination of t, running the
+// lifecycle hooks and the transition action for the change. States are exited
+// and entered along the path between curr and the destination (see route).
+// The action runs last, immediately before the state is changed, so that a
+// failing hook prevents it and a failing action prevents the change.
+// The caller must hold m.mu.
+func (m *Machine) commit(ctx context.Context, value interface{}, curr State, t Transition) (bool, error) {
+	if t.To() == nil {
+		return true, nil
 	}
 
-	for _, t := range transitions {
-		success, err := t.Go(ctx, value)
-		if err != nil {
+	to := m.resolve(t.To())
+	exited, entered := route(curr, to, t)
+
+	for _, s := range exited {
+		if err := runHooks(ctx, m.onExit[s.Name()], value, curr, to, t); err != nil {
 			return false, err
 		}
+	}
+	if err := runHooks(ctx, m.onTransition, value, curr, to, t); err != nil {
+		return false, err
+	}
+	if err := t.Exec(ctx, value); err != nil {
+		return false, err
+	}
 
-		if success {
-			to := t.To()
-			if to != nil {
-				m.curr.Store(to)
-			}
+	m.curr.Store(to)
+	m.remember(curr, exited)
+	m.record(ctx, curr, to, t)
+
+	complete := m.terminates(to)
+	if complete {
+		m.setCompleted(true)
+		m.rearm()
+	} else {
+		for _, s := range exited {
+			m.disarm(s.Id())
+		}
+		for _, s := range entered {
+			m.arm(s)
+		}
+	}
 
-			return true, nil
+	for _, s := range entered {
+		if err := runHooks(ctx, m.onEnter[s.Name()], value, curr, to, t); err != nil {
+			return true, err
+		}
+	}
+	if complete {
+		if err := runHooks(ctx, m.onComplete, value, curr, to, t); err != nil {
+			return true, err
 		}
 	}
 
-	return false, nil
+	return true, nil
 }
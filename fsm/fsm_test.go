@@ -2,10 +2,18 @@ package fsm
 
 import (
 	"context"
+	"errors"
 	"reflect"
 	"testing"
 )
 
+// is returns a TriggerFunc that matches the value want.
+func is(want string) TriggerFunc {
+	return func(_ context.Context, v interface{}) (bool, error) {
+		return v == want, nil
+	}
+}
+
 // PlantUML for this state Machine
 /*
 @startuml
@@ -452,3 +460,96 @@ func TestMachine(t *testing.T) {
 		})
 	})
 }
+
+func TestTransitionAction(t *testing.T) {
+	isByte := func(want byte) TriggerFunc {
+		return func(_ context.Context, v interface{}) (bool, error) {
+			b, ok := v.(byte)
+			return ok && b == want, nil
+		}
+	}
+
+	t.Run("runs before commit", func(t *testing.T) {
+		s1 := NewState("STATE1")
+		s2 := NewState("STATE2")
+
+		var m *Machine
+		var ran bool
+		tr := s1.When("v == 'a'", isByte('a')).Do(func(_ context.Context, v interface{}) error {
+			if v.(byte) != 'a' {
+				t.Fatal("unexpected action value")
+			}
+			if c, _ := m.curr.Load().(State); c != nil && c.Id() != s1.Id() {
+				t.Fatal("action ran after commit")
+			}
+			ran = true
+			return nil
+		}).Then(s2)
+		m = NewMachine(WithTransitions(tr))
+
+		changed, err := m.Update(context.Background(), byte('a'))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !changed || !ran {
+			t.Fatal("expected action and change")
+		}
+		if m.Current().Id() != s2.Id() {
+			t.Fatal("expected STATE2")
+		}
+	})
+
+	t.Run("error leaves state unchanged", func(t *testing.T) {
+		s1 := NewState("STATE1")
+		s2 := NewState("STATE2")
+		errAction := errors.New("action")
+
+		var entered bool
+		m := NewMachine(
+			WithTransitions(s1.When("v == 'a'", isByte('a')).Do(func(context.Context, interface{}) error {
+				return errAction
+			}).Then(s2)),
+			WithOnEnter("STATE2", func(context.Context, interface{}, State, State, Transition) error {
+				entered = true
+				return nil
+			}),
+		)
+
+		changed, err := m.Update(context.Background(), byte('a'))
+		if !errors.Is(err, errAction) {
+			t.Fatalf("expected action error, got %v", err)
+		}
+		if changed {
+			t.Fatal("unexpected change")
+		}
+		if entered {
+			t.Fatal("unexpected enter hook call")
+		}
+		if m.Current().Id() != s1.Id() {
+			t.Fatal("expected STATE1")
+		}
+	})
+
+	t.Run("not run when hook aborts", func(t *testing.T) {
+		s1 := NewState("STATE1")
+		s2 := NewState("STATE2")
+
+		var ran bool
+		m := NewMachine(
+			WithTransitions(s1.When("v == 'a'", isByte('a')).Do(func(context.Context, interface{}) error {
+				ran = true
+				return nil
+			}).Then(s2)),
+			WithOnExit("STATE1", func(context.Context, interface{}, State, State, Transition) error {
+				return errors.New("exit")
+			}),
+		)
+
+		if _, err := m.Update(context.Background(), byte('a')); err == nil {
+			t.Fatal("expected error")
+		}
+		if ran {
+			t.Fatal("unexpected action")
+		}
+	})
+}
@@ -0,0 +1,176 @@
+package fsm
+
+import (
+	"fmt"
+	"strings"
+)
+
+// GraphOption is a function type used to configure the DOT and Mermaid exporters.
+type GraphOption func(*graphConfig)
+
+// graphConfig holds the settings for a graph export.
+type graphConfig struct {
+	current bool // Whether to highlight the current state
+}
+
+// WithHighlightCurrent creates a GraphOption that highlights the current state
+// of the Machine in the exported graph.
+func WithHighlightCurrent() GraphOption {
+	return func(c *graphConfig) {
+		c.current = true
+	}
+}
+
+// graphData is a consistent, ordered view of the Machine used by the exporters.
+type graphData struct {
+	states      []State         // All states, ordered by id
+	transitions []Transition    // All transitions, ordered by source state id
+	start       State           // The start state, if any
+	current     State           // The current state, if it is to be highlighted
+	end         map[uint64]bool // Ids of the end states
+}
+
+// graph collects the data for a graph export.
+func (m *Machine) graph(opts []GraphOption) graphData {
+	var c graphConfig
+	for _, f := range opts {
+		f(&c)
+	}
+
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	g := graphData{
+		states: m.states(),
+		end:    make(map[uint64]bool, len(m.endStates)),
+	}
+	g.start, _ = m.start.Load().(State)
+	if c.current {
+		g.current = m.current()
+	}
+	for id := range m.endStates {
+		g.end[id] = true
+	}
+	for _, s := range g.states {
+		g.transitions = append(g.transitions, m.transitions[s.Id()]...)
+	}
+
+	return g
+}
+
+// DOT renders the Machine as a Graphviz DOT digraph.
+// The start state is marked by an edge from a point node, end states are drawn
+// as double circles and, with WithHighlightCurrent, the current state is filled.
+// Transitions are labelled with their events and descriptions.
+//
+// Example:
+//
+//	if err := ioutil.WriteFile("machine.dot", []byte(m.DOT()), 0644); err != nil {
+//	    // handle error
+//	}
+func (m *Machine) DOT(opts ...GraphOption) string {
+	g := m.graph(opts)
+	sb := strings.Builder{}
+
+	sb.WriteString("digraph fsm {\n")
+	sb.WriteString("\trankdir=LR;\n")
+	if g.start != nil {
+		sb.WriteString("\t__start [shape=point];\n")
+	}
+
+	for _, s := range g.states {
+		var attrs []string
+		if g.end[s.Id()] {
+			attrs = append(attrs, "shape=doublecircle")
+		}
+		if g.current != nil && g.current.Id() == s.Id() {
+			attrs = append(attrs, "style=filled", "fillcolor=lightblue")
+		}
+		if len(attrs) == 0 {
+			sb.WriteString(fmt.Sprintf("\t%s;\n", dotQuote(s.Name())))
+			continue
+		}
+		sb.WriteString(fmt.Sprintf("\t%s [%s];\n", dotQuote(s.Name()), strings.Join(attrs, ", ")))
+	}
+
+	if g.start != nil {
+		sb.WriteString(fmt.Sprintf("\t__start -> %s;\n", dotQuote(g.start.Name())))
+	}
+	for _, t := range g.transitions {
+		sb.WriteString(fmt.Sprintf("\t%s -> %s [label=%s];\n",
+			dotQuote(t.From().Name()), dotQuote(origin(t.To()).Name()), dotQuote(label(t))))
+	}
+
+	sb.WriteString("}\n")
+
+	return sb.String()
+}
+
+// Mermaid renders the Machine as a Mermaid stateDiagram-v2.
+// The start state is entered from [*], end states lead to [*] and, with
+// WithHighlightCurrent, the current state is given the "current" class.
+// Transitions are labelled with their events and descriptions.
+//
+// Example:
+//
+//	fmt.Println("```mermaid")
+//	fmt.Print(m.Mermaid(fsm.WithHighlightCurrent()))
+//	fmt.Println("```")
+func (m *Machine) Mermaid(opts ...GraphOption) string {
+	g := m.graph(opts)
+	sb := strings.Builder{}
+
+	sb.WriteString("stateDiagram-v2\n")
+	for _, s := range g.states {
+		sb.WriteString(fmt.Sprintf("\tstate \"%s\" as %s\n", mermaidEscape(s.Name()), mermaidID(s)))
+	}
+
+	if g.start != nil {
+		sb.WriteString(fmt.Sprintf("\t[*] --> %s\n", mermaidID(g.start)))
+	}
+	for _, t := range g.transitions {
+		sb.WriteString(fmt.Sprintf("\t%s --> %s", mermaidID(t.From()), mermaidID(origin(t.To()))))
+		if l := label(t); l != "" {
+			sb.WriteString(" : " + mermaidEscape(l))
+		}
+		sb.WriteString("\n")
+	}
+	for _, s := range g.states {
+		if g.end[s.Id()] {
+			sb.WriteString(fmt.Sprintf("\t%s --> [*]\n", mermaidID(s)))
+		}
+	}
+
+	if g.current != nil {
+		sb.WriteString("\tclassDef current fill:#add8e6\n")
+		sb.WriteString(fmt.Sprintf("\tclass %s current\n", mermaidID(g.current)))
+	}
+
+	return sb.String()
+}
+
+// label returns the label of a transition: its description, prefixed by
+// its event when the two differ.
+func label(t Transition) string {
+	trigger, desc := string(t.Trigger()), t.Description()
+	if trigger == "" || trigger == desc {
+		return desc
+	}
+	return fmt.Sprintf("%s [%s]", trigger, desc)
+}
+
+// dotQuote returns s as a quoted DOT identifier.
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	return `"` + strings.ReplaceAll(s, `"`, `\"`) + `"`
+}
+
+// mermaidID returns the identifier used for a state in Mermaid diagrams.
+func mermaidID(s State) string {
+	return fmt.Sprintf("s%d", s.Id())
+}
+
+// mermaidEscape replaces characters that cannot appear in Mermaid labels.
+func mermaidEscape(s string) string {
+	return strings.NewReplacer(`"`, "#quot;", "\n", " ").Replace(s)
+}
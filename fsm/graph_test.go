@@ -0,0 +1,100 @@
+package fsm
+
+import (
+	"context"
+	"fmt"
+	"testing"
+)
+
+func TestGraph(t *testing.T) {
+	never := func(context.Context, interface{}) (bool, error) {
+		return false, nil
+	}
+	always := func(context.Context, interface{}) (bool, error) {
+		return true, nil
+	}
+
+	s1 := NewState("IDLE")
+	s2 := NewState("RUNNING")
+	s3 := NewState(`DONE "ok"`)
+	m := NewMachine(WithTransitions(
+		s1.When("start", always).Then(s2),
+		s2.When("finish", never).Then(s3),
+		s2.When("abort", never).Then(s1),
+	))
+	if err := m.SetEndStates(`DONE "ok"`); err != nil {
+		t.Fatal(err)
+	}
+
+	t.Run("dot", func(t *testing.T) {
+		const expected = `digraph fsm {
+	rankdir=LR;
+	__start [shape=point];
+	"IDLE";
+	"RUNNING";
+	"DONE \"ok\"" [shape=doublecircle];
+	__start -> "IDLE";
+	"IDLE" -> "RUNNING" [label="start"];
+	"RUNNING" -> "DONE \"ok\"" [label="finish"];
+	"RUNNING" -> "IDLE" [label="abort"];
+}
+`
+		if got := m.DOT(); got != expected {
+			t.Fatalf("expected:\n%s\ngot:\n%s", expected, got)
+		}
+	})
+
+	t.Run("mermaid", func(t *testing.T) {
+		expected := fmt.Sprintf(`stateDiagram-v2
+	state "IDLE" as s%[1]d
+	state "RUNNING" as s%[2]d
+	state "DONE #quot;ok#quot;" as s%[3]d
+	[*] --> s%[1]d
+	s%[1]d --> s%[2]d : start
+	s%[2]d --> s%[3]d : finish
+	s%[2]d --> s%[1]d : abort
+	s%[3]d --> [*]
+`, s1.Id(), s2.Id(), s3.Id())
+		if got := m.Mermaid(); got != expected {
+			t.Fatalf("expected:\n%s\ngot:\n%s", expected, got)
+		}
+	})
+
+	t.Run("highlight current", func(t *testing.T) {
+		if _, err := m.Update(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+
+		const expectedDOT = `digraph fsm {
+	rankdir=LR;
+	__start [shape=point];
+	"IDLE";
+	"RUNNING" [style=filled, fillcolor=lightblue];
+	"DONE \"ok\"" [shape=doublecircle];
+	__start -> "IDLE";
+	"IDLE" -> "RUNNING" [label="start"];
+	"RUNNING" -> "DONE \"ok\"" [label="finish"];
+	"RUNNING" -> "IDLE" [label="abort"];
+}
+`
+		if got := m.DOT(WithHighlightCurrent()); got != expectedDOT {
+			t.Fatalf("expected:\n%s\ngot:\n%s", expectedDOT, got)
+		}
+
+		expectedMermaid := fmt.Sprintf(`stateDiagram-v2
+	state "IDLE" as s%[1]d
+	state "RUNNING" as s%[2]d
+	state "DONE #quot;ok#quot;" as s%[3]d
+	[*] --> s%[1]d
+	s%[1]d --> s%[2]d : start
+	s%[2]d --> s%[3]d : finish
+	s%[2]d --> s%[1]d : abort
+	s%[3]d --> [*]
+	classDef current fill:#add8e6
+	class s%[2]d current
+`, s1.Id(), s2.Id(), s3.Id())
+		if got := m.Mermaid(WithHighlightCurrent()); got != expectedMermaid {
+			t.Fatalf("expected:\n%s\ngot:\n%s", expectedMermaid, got)
+		}
+	})
+}
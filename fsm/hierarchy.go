@@ -0,0 +1,234 @@
+package fsm
+
+import (
+	"time"
+)
+
+// ActivePath returns the current state and all of its ancestors, outermost first.
+// For a Machine without hierarchical states it contains only the current state.
+//
+// Example:
+//
+//	for _, s := range Machine.ActivePath() {
+//	    fmt.Print("/", s.Name())
+//	}
+func (m *Machine) ActivePath() []State {
+	curr := m.Current()
+	if curr == nil {
+		return nil
+	}
+
+	return path(curr)
+}
+
+// ancestry returns s followed by its ancestors, innermost first.
+func ancestry(s State) []State {
+	var out []State
+	for ; s != nil; s = s.Parent() {
+		out = append(out, s)
+	}
+	return out
+}
+
+// path returns the ancestors of s followed by s, outermost first.
+func path(s State) []State {
+	out := ancestry(s)
+	for i, j := 0, len(out)-1; i < j; i, j = i+1, j-1 {
+		out[i], out[j] = out[j], out[i]
+	}
+	return out
+}
+
+// isInitial reports whether s is the initial sub-state of its parent.
+func isInitial(s State) bool {
+	i, ok := s.(interface{ isInitial() bool })
+	return ok && i.isInitial() && s.Parent() != nil
+}
+
+// descends reports whether ancestor is a proper ancestor of s.
+func descends(s, ancestor State) bool {
+	for p := s.Parent(); p != nil; p = p.Parent() {
+		if p.Id() == ancestor.Id() {
+			return true
+		}
+	}
+	return false
+}
+
+// lca returns the innermost state that is a proper ancestor of both a and b,
+// or nil if they have none in common.
+func lca(a, b State) State {
+	ancestors := make(map[uint64]bool)
+	for p := a.Parent(); p != nil; p = p.Parent() {
+		ancestors[p.Id()] = true
+	}
+	for p := b.Parent(); p != nil; p = p.Parent() {
+		if ancestors[p.Id()] {
+			return p
+		}
+	}
+	return nil
+}
+
+// resolve returns the state actually entered when s is targeted, following
+// initial sub-states down from s. History pseudo-states are resolved to the
+// remembered configuration of their parent. The caller must hold m.mu.
+func (m *Machine) resolve(s State) State {
+	return resolve(m.initial, m.shallow, m.deep, s)
+}
+
+// resolve returns the state entered when s is targeted, given the initial
+// sub-states and the configuration remembered for history pseudo-states.
+func resolve(initial, shallow, deep map[uint64]State, s State) State {
+	if h, ok := s.(historyState); ok {
+		s = h.parent
+		if last, ok := deep[s.Id()]; ok && h.deep {
+			return last
+		}
+		if last, ok := shallow[s.Id()]; ok {
+			s = last
+		}
+	}
+
+	for s != nil {
+		child, ok := initial[s.Id()]
+		if !ok {
+			break
+		}
+		s = child
+	}
+	return s
+}
+
+// index registers the initial sub-states among s and its ancestors.
+// The caller must hold m.mu.
+func (m *Machine) index(s State) {
+	for ; s != nil; s = s.Parent() {
+		if isInitial(s) {
+			if m.initial == nil {
+				m.initial = make(map[uint64]State)
+			}
+			m.initial[s.Parent().Id()] = s
+		}
+	}
+}
+
+// route returns the states exited and entered when t fires while curr is the
+// current state and target is the resolved destination. Exited states are
+// innermost first and entered states outermost first. Transitions are external:
+// the source and destination of t are always exited and entered, even for a
+// self-transition.
+func route(curr, target State, t Transition) (exited, entered []State) {
+	top := lca(t.From(), t.To())
+
+	for s := curr; s != nil && (top == nil || s.Id() != top.Id()); s = s.Parent() {
+		exited = append(exited, s)
+	}
+	for s := target; s != nil && (top == nil || s.Id() != top.Id()); s = s.Parent() {
+		entered = append(entered, s)
+	}
+	for i, j := 0, len(entered)-1; i < j; i, j = i+1, j-1 {
+		entered[i], entered[j] = entered[j], entered[i]
+	}
+
+	return exited, entered
+}
+
+// historyState is a pseudo-state that stands for the last active
+// configuration of its parent. See HistoryOf and DeepHistoryOf.
+type historyState struct {
+	id     uint64 // Unique identifier for the pseudo-state
+	parent State  // State whose history is restored
+	deep   bool   // Whether the whole configuration is restored
+}
+
+// HistoryOf returns a shallow history pseudo-state of parent. A transition
+// that targets it enters the child of parent that was active when parent was
+// last exited, and that child's initial sub-states below it. If parent was
+// never exited, parent is entered as usual.
+// A history pseudo-state can only be used as the destination of a transition.
+//
+// Example:
+//
+//	paused.On("resume").Then(fsm.HistoryOf(processing))
+func HistoryOf(parent State) State {
+	return historyState{id: mkID(), parent: parent}
+}
+
+// DeepHistoryOf returns a deep history pseudo-state of parent. A transition
+// that targets it enters the innermost state that was active when parent was
+// last exited, and every state between the two. If parent was never exited,
+// parent is entered as usual.
+// A history pseudo-state can only be used as the destination of a transition.
+//
+// Example:
+//
+//	paused.On("resume").Then(fsm.DeepHistoryOf(processing))
+func DeepHistoryOf(parent State) State {
+	return historyState{id: mkID(), parent: parent, deep: true}
+}
+
+// Id returns the unique identifier for this pseudo-state.
+func (h historyState) Id() uint64 {
+	return h.id
+}
+
+// Name returns the name of the parent followed by "(H)", or "(H*)" for deep history.
+func (h historyState) Name() string {
+	if h.deep {
+		return h.parent.Name() + "(H*)"
+	}
+	return h.parent.Name() + "(H)"
+}
+
+// Parent returns the state whose history is restored.
+func (h historyState) Parent() State {
+	return h.parent
+}
+
+// When panics: a history pseudo-state cannot have outgoing transitions.
+func (h historyState) When(string, TriggerFunc) Transition {
+	panic("history pseudo-state cannot have outgoing transitions")
+}
+
+// On panics: a history pseudo-state cannot have outgoing transitions.
+func (h historyState) On(Trigger) Transition {
+	panic("history pseudo-state cannot have outgoing transitions")
+}
+
+// After panics: a history pseudo-state cannot have outgoing transitions.
+func (h historyState) After(time.Duration) Transition {
+	panic("history pseudo-state cannot have outgoing transitions")
+}
+
+// origin returns the parent of a history pseudo-state, or s itself for any
+// other state.
+func origin(s State) State {
+	if h, ok := s.(historyState); ok {
+		return h.parent
+	}
+	return s
+}
+
+// remember records the configuration of every composite state exited while
+// leaving curr, so that history pseudo-states can restore it. exited must be
+// innermost first, as returned by route. The caller must hold m.mu.
+func (m *Machine) remember(curr State, exited []State) {
+	m.shallow, m.deep = remember(m.shallow, m.deep, curr, exited)
+}
+
+// remember records the configuration of every composite state exited while
+// leaving curr in shallow and deep, creating them if needed, and returns them.
+func remember(shallow, deep map[uint64]State, curr State, exited []State) (map[uint64]State, map[uint64]State) {
+	for i := 1; i < len(exited); i++ {
+		if shallow == nil {
+			shallow = make(map[uint64]State)
+		}
+		if deep == nil {
+			deep = make(map[uint64]State)
+		}
+		shallow[exited[i].Id()] = exited[i-1]
+		deep[exited[i].Id()] = curr
+	}
+	return shallow, deep
+}
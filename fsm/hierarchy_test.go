@@ -0,0 +1,363 @@
+package fsm
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestHierarchy(t *testing.T) {
+	mkMachine := func(t *testing.T) (*Machine, *[]string) {
+		t.Helper()
+
+		pending := NewState("PENDING")
+		processing := NewState("PROCESSING")
+		validating := NewState("VALIDATING", WithParent(processing), AsInitial())
+		packing := NewState("PACKING", WithParent(processing))
+		shipped := NewState("SHIPPED")
+		cancelled := NewState("CANCELLED")
+
+		var trace []string
+		hook := func(kind string) HookFunc {
+			return func(context.Context, interface{}, State, State, Transition) error {
+				trace = append(trace, kind)
+				return nil
+			}
+		}
+
+		m := NewMachine(
+			WithTransitions(
+				pending.When("accepted", is("accept")).Then(processing),
+				validating.When("valid", is("valid")).Then(packing),
+				packing.When("repack", is("repack")).Then(packing),
+				packing.When("packed", is("packed")).Then(shipped),
+				processing.On("cancel").Then(cancelled),
+			),
+		)
+		for _, name := range []string{"PENDING", "PROCESSING", "VALIDATING", "PACKING", "CANCELLED"} {
+			WithOnEnter(name, hook("enter "+name))(m)
+			WithOnExit(name, hook("exit "+name))(m)
+		}
+		if err := m.SetEndStates("SHIPPED", "CANCELLED"); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		return m, &trace
+	}
+
+	names := func(states []State) []string {
+		out := make([]string, len(states))
+		for i, s := range states {
+			out[i] = s.Name()
+		}
+		return out
+	}
+
+	t.Run("initial sub-state", func(t *testing.T) {
+		m, trace := mkMachine(t)
+		if _, err := m.Update(context.Background(), "accept"); err != nil {
+			t.Fatal(err)
+		}
+		if got := names(m.ActivePath()); !reflect.DeepEqual(got, []string{"PROCESSING", "VALIDATING"}) {
+			t.Fatalf("unexpected active path: %v", got)
+		}
+		want := []string{"exit PENDING", "enter PROCESSING", "enter VALIDATING"}
+		if !reflect.DeepEqual(*trace, want) {
+			t.Fatalf("expected %v, got %v", want, *trace)
+		}
+	})
+
+	t.Run("sibling transition", func(t *testing.T) {
+		m, trace := mkMachine(t)
+		ctx := context.Background()
+		for _, v := range []string{"accept", "valid"} {
+			if _, err := m.Update(ctx, v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		want := []string{
+			"exit PENDING", "enter PROCESSING", "enter VALIDATING",
+			"exit VALIDATING", "enter PACKING",
+		}
+		if !reflect.DeepEqual(*trace, want) {
+			t.Fatalf("expected %v, got %v", want, *trace)
+		}
+	})
+
+	t.Run("self transition", func(t *testing.T) {
+		m, trace := mkMachine(t)
+		ctx := context.Background()
+		for _, v := range []string{"accept", "valid"} {
+			if _, err := m.Update(ctx, v); err != nil {
+				t.Fatal(err)
+			}
+		}
+		*trace = nil
+		if changed, err := m.Update(ctx, "repack"); !changed || err != nil {
+			t.Fatalf("unexpected result: %v, %v", changed, err)
+		}
+		if want := []string{"exit PACKING", "enter PACKING"}; !reflect.DeepEqual(*trace, want) {
+			t.Fatalf("expected %v, got %v", want, *trace)
+		}
+	})
+
+	t.Run("inherited transition", func(t *testing.T) {
+		for _, steps := range [][]string{{"accept"}, {"accept", "valid"}} {
+			m, trace := mkMachine(t)
+			ctx := context.Background()
+			for _, v := range steps {
+				if _, err := m.Update(ctx, v); err != nil {
+					t.Fatal(err)
+				}
+			}
+			leaf := m.Current().Name()
+			*trace = nil
+
+			if changed, err := m.Fire(ctx, "cancel", nil); !changed || err != nil {
+				t.Fatalf("unexpected result: %v, %v", changed, err)
+			}
+			if m.Current().Name() != "CANCELLED" {
+				t.Fatalf("expected CANCELLED, got %s", m.Current().Name())
+			}
+			want := []string{"exit " + leaf, "exit PROCESSING", "enter CANCELLED"}
+			if !reflect.DeepEqual(*trace, want) {
+				t.Fatalf("expected %v, got %v", want, *trace)
+			}
+		}
+	})
+
+	t.Run("inner transitions first", func(t *testing.T) {
+		parent := NewState("PARENT")
+		child := NewState("CHILD", WithParent(parent), AsInitial())
+		a, b := NewState("A"), NewState("B")
+		always := func(context.Context, interface{}) (bool, error) { return true, nil }
+
+		m := NewMachine(WithTransitions(
+			a.When("go", always).Then(parent),
+			parent.When("parent", always).Then(a),
+			child.When("child", always).Then(b),
+		))
+		if _, err := m.Update(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := m.Update(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if m.Current().Id() != b.Id() {
+			t.Fatalf("expected B, got %s", m.Current().Name())
+		}
+	})
+
+	t.Run("start and reset", func(t *testing.T) {
+		m, _ := mkMachine(t)
+		if err := m.SetStart("PROCESSING"); err != nil {
+			t.Fatal(err)
+		}
+		if m.Current().Name() != "VALIDATING" {
+			t.Fatalf("expected VALIDATING, got %s", m.Current().Name())
+		}
+		if _, err := m.Update(context.Background(), "valid"); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Reset(); err != nil {
+			t.Fatal(err)
+		}
+		if m.Current().Name() != "VALIDATING" {
+			t.Fatalf("expected VALIDATING, got %s", m.Current().Name())
+		}
+	})
+
+	t.Run("composite start", func(t *testing.T) {
+		mk := func() *Machine {
+			p := NewState("P")
+			a := NewState("A", WithParent(p), AsInitial())
+			b := NewState("B")
+			return NewMachine(WithTransitions(
+				p.On("reset").Then(p),
+				a.On("x").Then(b),
+			))
+		}
+
+		m := mk()
+		snap := m.Snapshot()
+		if snap.Start != "P" || snap.Current != "A" {
+			t.Fatalf("unexpected snapshot: %+v", snap)
+		}
+		if got := m.DOT(WithHighlightCurrent()); !strings.Contains(got, `"A" [style=filled, fillcolor=lightblue];`) {
+			t.Fatalf("expected A to be highlighted:\n%s", got)
+		}
+
+		// a snapshot naming the composite state enters its initial sub-state
+		snap.Current = "P"
+		restored := mk()
+		if err := restored.Restore(snap); err != nil {
+			t.Fatal(err)
+		}
+		if restored.Current().Name() != "A" {
+			t.Fatalf("expected A, got %s", restored.Current().Name())
+		}
+		if changed, err := restored.Fire(context.Background(), "x", nil); !changed || err != nil {
+			t.Fatalf("unexpected result: %v, %v", changed, err)
+		}
+	})
+
+	t.Run("analysis", func(t *testing.T) {
+		parent := NewState("PARENT")
+		child := NewState("CHILD", WithParent(parent))
+		a, b := NewState("A"), NewState("B")
+		always := func(context.Context, interface{}) (bool, error) { return true, nil }
+
+		// CHILD is not the initial sub-state, so entering PARENT never enters it
+		m := NewMachine(WithTransitions(
+			a.When("go", always).Then(parent),
+			parent.When("done", always).Then(b),
+			child.When("loop", always).Then(child),
+		))
+		if err := m.SetEndStates("B"); err != nil {
+			t.Fatal(err)
+		}
+
+		err := m.Validate()
+		if err == nil || !strings.Contains(err.Error(), "state 'CHILD' is not reachable") {
+			t.Fatalf("expected CHILD to be unreachable, got %v", err)
+		}
+		for _, p := range m.Analyze().Problems {
+			if p.Kind == ProblemDeadEnd {
+				t.Fatalf("unexpected dead end: %s", p.Message)
+			}
+		}
+	})
+}
+
+func TestHistoryStates(t *testing.T) {
+	always := func(context.Context, interface{}) (bool, error) { return true, nil }
+
+	mkMachine := func() *Machine {
+		processing := NewState("PROCESSING")
+		validating := NewState("VALIDATING", WithParent(processing), AsInitial())
+		packing := NewState("PACKING", WithParent(processing))
+		wrapping := NewState("WRAPPING", WithParent(packing), AsInitial())
+		labelling := NewState("LABELLING", WithParent(packing))
+		paused := NewState("PAUSED")
+
+		return NewMachine(WithTransitions(
+			validating.On("valid").Then(packing),
+			wrapping.On("wrapped").Then(labelling),
+			processing.On("pause").Then(paused),
+			paused.On("resume").Then(HistoryOf(processing)),
+			paused.On("resume deep").Then(DeepHistoryOf(processing)),
+			paused.On("restart").Then(processing),
+			labelling.When("done", always).Then(paused),
+		))
+	}
+
+	fire := func(t *testing.T, m *Machine, triggers ...Trigger) {
+		t.Helper()
+		for _, trigger := range triggers {
+			if changed, err := m.Fire(context.Background(), trigger, nil); !changed || err != nil {
+				t.Fatalf("%s: unexpected result: %v, %v", trigger, changed, err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name     string
+		triggers []Trigger
+		want     string
+	}{
+		{"never exited", []Trigger{"pause", "resume"}, "VALIDATING"},
+		{"shallow", []Trigger{"valid", "wrapped", "pause", "resume"}, "WRAPPING"},
+		{"deep", []Trigger{"valid", "wrapped", "pause", "resume deep"}, "LABELLING"},
+		{"initial", []Trigger{"valid", "wrapped", "pause", "restart"}, "VALIDATING"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mkMachine()
+			fire(t, m, tt.triggers...)
+			if m.Current().Name() != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, m.Current().Name())
+			}
+		})
+	}
+
+	t.Run("reset forgets", func(t *testing.T) {
+		m := mkMachine()
+		fire(t, m, "valid", "pause")
+		if err := m.Reset(); err != nil {
+			t.Fatal(err)
+		}
+		fire(t, m, "pause", "resume")
+		if m.Current().Name() != "VALIDATING" {
+			t.Fatalf("expected VALIDATING, got %s", m.Current().Name())
+		}
+	})
+
+	t.Run("snapshot", func(t *testing.T) {
+		m := mkMachine()
+		fire(t, m, "valid", "wrapped", "pause")
+
+		var buf bytes.Buffer
+		if err := (JSONCodec{}).Encode(&buf, m.Snapshot()); err != nil {
+			t.Fatal(err)
+		}
+		snap, err := JSONCodec{}.Decode(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if snap.ShallowHistory["PROCESSING"] != "PACKING" || snap.DeepHistory["PACKING"] != "LABELLING" {
+			t.Fatalf("unexpected snapshot: %+v", snap)
+		}
+
+		restored := mkMachine()
+		if err := restored.Restore(snap); err != nil {
+			t.Fatal(err)
+		}
+		fire(t, restored, "resume deep")
+		if restored.Current().Name() != "LABELLING" {
+			t.Fatalf("expected LABELLING, got %s", restored.Current().Name())
+		}
+
+		// a restored deep history is kept when the shallow history is empty
+		partial := mkMachine()
+		if err := partial.Restore(Snapshot{
+			Version:     SnapshotVersion,
+			Current:     "VALIDATING",
+			Start:       "PROCESSING",
+			DeepHistory: map[string]string{"PACKING": "LABELLING"},
+		}); err != nil {
+			t.Fatal(err)
+		}
+		fire(t, partial, "pause")
+		if got := partial.Snapshot().DeepHistory; got["PACKING"] != "LABELLING" || got["PROCESSING"] != "VALIDATING" {
+			t.Fatalf("unexpected deep history: %v", got)
+		}
+
+		snap.DeepHistory["PROCESSING"] = "PAUSED"
+		if err := mkMachine().Restore(snap); err == nil {
+			t.Fatal("expected invalid history error")
+		}
+	})
+
+	t.Run("analysis and graph", func(t *testing.T) {
+		m := mkMachine()
+		if err := m.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		if dot := m.DOT(); strings.Contains(dot, "(H") {
+			t.Fatalf("unexpected pseudo-state in graph:\n%s", dot)
+		}
+	})
+
+	t.Run("no outgoing transitions", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected panic")
+			}
+		}()
+		HistoryOf(NewState("PARENT")).On("go")
+	})
+}
@@ -0,0 +1,166 @@
+package fsm
+
+import (
+	"context"
+	"time"
+)
+
+// HistoryEntry records a single successful transition of a Machine.
+type HistoryEntry struct {
+	From          string    `json:"from"`                     // Name of the state that was left
+	To            string    `json:"to"`                       // Name of the state that was entered
+	TransitionID  uint64    `json:"transition_id"`            // Id of the transition that fired
+	Description   string    `json:"description"`              // Description of the transition that fired
+	Trigger       Trigger   `json:"trigger,omitempty"`        // Event passed to Fire, if any
+	Time          time.Time `json:"time"`                     // Time the transition was committed
+	CorrelationID string    `json:"correlation_id,omitempty"` // Correlation ID from the Update context, if any
+}
+
+// HistorySink receives every HistoryEntry recorded by a Machine.
+// Record is called while the Machine is locked, so it must not call back
+// into the Machine and should return quickly.
+type HistorySink interface {
+	Record(HistoryEntry)
+}
+
+// HistorySinkFunc is an adapter that allows an ordinary function to be used as a HistorySink.
+type HistorySinkFunc func(HistoryEntry)
+
+// Record calls f(e).
+func (f HistorySinkFunc) Record(e HistoryEntry) {
+	f(e)
+}
+
+// WithHistory creates an Option that makes the Machine keep the last n
+// transitions in memory. They can be retrieved with Machine.History.
+// A non-positive n disables the in-memory history.
+//
+// Example:
+//
+//	m := fsm.NewMachine(fsm.WithTransitions(t1, t2), fsm.WithHistory(100))
+func WithHistory(n int) Option {
+	return func(m *Machine) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		if n <= 0 {
+			m.history = nil
+			return
+		}
+		m.history = &historyRing{buf: make([]HistoryEntry, n)}
+	}
+}
+
+// WithHistorySink creates an Option that sends every transition of the Machine
+// to the given sink. It can be combined with WithHistory and used more than once.
+//
+// Example:
+//
+//	m := fsm.NewMachine(
+//		fsm.WithTransitions(t1, t2),
+//		fsm.WithHistorySink(fsm.HistorySinkFunc(func(e fsm.HistoryEntry) {
+//			log.Printf("%s: %s -> %s", e.CorrelationID, e.From, e.To)
+//		})),
+//	)
+func WithHistorySink(sink HistorySink) Option {
+	return func(m *Machine) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		m.sinks = append(m.sinks, sink)
+	}
+}
+
+// correlationKey is the context key for correlation IDs.
+type correlationKey struct{}
+
+// WithCorrelationID returns a copy of ctx carrying the given correlation ID.
+// When the context is passed to Machine.Update, the ID is stored in the
+// recorded HistoryEntry.
+//
+// Example:
+//
+//	ctx = fsm.WithCorrelationID(ctx, orderID)
+//	changed, err := m.Update(ctx, event)
+func WithCorrelationID(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, correlationKey{}, id)
+}
+
+// CorrelationID returns the correlation ID carried by ctx, or an empty string.
+func CorrelationID(ctx context.Context) string {
+	id, _ := ctx.Value(correlationKey{}).(string)
+	return id
+}
+
+// History returns the transitions recorded by the Machine, oldest first.
+// It returns nil unless the Machine was created with WithHistory.
+//
+// Example:
+//
+//	for _, e := range m.History() {
+//	    fmt.Printf("%s -> %s (%s)\n", e.From, e.To, e.Description)
+//	}
+func (m *Machine) History() []HistoryEntry {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	if m.history == nil {
+		return nil
+	}
+	return m.history.entries()
+}
+
+// record stores a HistoryEntry for the transition t and forwards it to all sinks.
+// The caller must hold m.mu.
+func (m *Machine) record(ctx context.Context, from, to State, t Transition) {
+	if m.history == nil && len(m.sinks) == 0 {
+		return
+	}
+
+	e := HistoryEntry{
+		From:          from.Name(),
+		To:            to.Name(),
+		TransitionID:  t.Id(),
+		Description:   t.Description(),
+		Trigger:       t.Trigger(),
+		Time:          m.now(),
+		CorrelationID: CorrelationID(ctx),
+	}
+
+	if m.history != nil {
+		m.history.add(e)
+	}
+	for _, s := range m.sinks {
+		s.Record(e)
+	}
+}
+
+// historyRing is a fixed-size ring buffer of history entries.
+type historyRing struct {
+	buf  []HistoryEntry // Backing storage
+	next int            // Index of the next write
+	full bool           // Whether the buffer has wrapped
+}
+
+// add appends an entry, overwriting the oldest one when the buffer is full.
+func (h *historyRing) add(e HistoryEntry) {
+	h.buf[h.next] = e
+	h.next++
+	if h.next == len(h.buf) {
+		h.next = 0
+		h.full = true
+	}
+}
+
+// entries returns a copy of the stored entries, oldest first.
+func (h *historyRing) entries() []HistoryEntry {
+	if !h.full {
+		out := make([]HistoryEntry, h.next)
+		copy(out, h.buf[:h.next])
+		return out
+	}
+
+	out := make([]HistoryEntry, 0, len(h.buf))
+	out = append(out, h.buf[h.next:]...)
+	return append(out, h.buf[:h.next]...)
+}
@@ -0,0 +1,102 @@
+package fsm
+
+import (
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestHistory(t *testing.T) {
+	s1 := NewState("STATE1")
+	s2 := NewState("STATE2")
+	transitions := []Transition{
+		s1.When("v == 'a'", func(_ context.Context, v interface{}) (bool, error) {
+			return v == byte('a'), nil
+		}).Then(s2),
+		s2.When("v == 'b'", func(_ context.Context, v interface{}) (bool, error) {
+			return v == byte('b'), nil
+		}).Then(s1),
+	}
+
+	names := func(entries []HistoryEntry) []string {
+		out := make([]string, 0, len(entries))
+		for _, e := range entries {
+			out = append(out, e.From+">"+e.To)
+		}
+		return out
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		m := NewMachine(WithTransitions(transitions...))
+		if _, err := m.Update(context.Background(), byte('a')); err != nil {
+			t.Fatal(err)
+		}
+		if h := m.History(); h != nil {
+			t.Fatalf("expected no history, got %v", h)
+		}
+	})
+
+	t.Run("entries", func(t *testing.T) {
+		m := NewMachine(WithTransitions(transitions...), WithHistory(10))
+		ctx := WithCorrelationID(context.Background(), "order-1")
+
+		for _, v := range []byte("axb") {
+			if _, err := m.Update(ctx, v); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		h := m.History()
+		if len(h) != 2 {
+			t.Fatalf("expected 2 entries, got %d", len(h))
+		}
+		if h[0].TransitionID != transitions[0].Id() || h[0].Description != "v == 'a'" {
+			t.Fatalf("unexpected entry: %+v", h[0])
+		}
+		if h[1].CorrelationID != "order-1" {
+			t.Fatalf("expected correlation ID, got %q", h[1].CorrelationID)
+		}
+		if h[0].Time.IsZero() || h[1].Time.Before(h[0].Time) {
+			t.Fatal("expected ordered timestamps")
+		}
+		if expected := []string{"STATE1>STATE2", "STATE2>STATE1"}; !reflect.DeepEqual(names(h), expected) {
+			t.Fatalf("expected %v, got %v", expected, names(h))
+		}
+	})
+
+	t.Run("bounded", func(t *testing.T) {
+		m := NewMachine(WithTransitions(transitions...), WithHistory(3))
+		for _, v := range []byte("ababa") {
+			if _, err := m.Update(context.Background(), v); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		expected := []string{"STATE1>STATE2", "STATE2>STATE1", "STATE1>STATE2"}
+		if got := names(m.History()); !reflect.DeepEqual(got, expected) {
+			t.Fatalf("expected %v, got %v", expected, got)
+		}
+	})
+
+	t.Run("sink", func(t *testing.T) {
+		var got []HistoryEntry
+		m := NewMachine(
+			WithTransitions(transitions...),
+			WithHistorySink(HistorySinkFunc(func(e HistoryEntry) {
+				got = append(got, e)
+			})),
+		)
+		for _, v := range []byte("ab") {
+			if _, err := m.Update(context.Background(), v); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		if expected := []string{"STATE1>STATE2", "STATE2>STATE1"}; !reflect.DeepEqual(names(got), expected) {
+			t.Fatalf("expected %v, got %v", expected, names(got))
+		}
+		if m.History() != nil {
+			t.Fatal("expected no in-memory history")
+		}
+	})
+}
@@ -0,0 +1,87 @@
+package fsm
+
+import (
+	"context"
+)
+
+// HookFunc is a function type invoked by the Machine when a transition fires.
+// It receives the context and value passed to Update, the state being left, the
+// state being entered and the Transition that fired.
+//
+// For every transition, hooks are run in the following order:
+// - exit hooks registered for the from state (WithOnExit)
+// - transition hooks (WithOnTransition)
+// - the transition action, if any (Transition.Do)
+// - the current state is changed
+// - enter hooks registered for the to state (WithOnEnter)
+//
+// Hooks of the same kind run in the order they were registered. An error returned
+// by an exit or transition hook aborts the transition: the current state is left
+// unchanged and Update returns (false, err). An error returned by an enter hook is
+// returned as (true, err), since the state has already changed.
+//
+// Hooks are called while the Machine is locked, so they must not call back
+// into the Machine.
+//
+// Example:
+//
+//	m := fsm.NewMachine(
+//		fsm.WithTransitions(t1, t2),
+//		fsm.WithOnEnter("STATE2", func(ctx context.Context, v interface{}, from, to fsm.State, t fsm.Transition) error {
+//			log.Printf("%s -> %s (%s)", from.Name(), to.Name(), t.Description())
+//			return nil
+//		}),
+//	)
+type HookFunc func(ctx context.Context, value interface{}, from, to State, t Transition) error
+
+// WithOnEnter creates an Option that registers a hook to be run after the Machine
+// enters the state with the given name.
+func WithOnEnter(name string, f HookFunc) Option {
+	return func(m *Machine) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		if m.onEnter == nil {
+			m.onEnter = make(map[string][]HookFunc)
+		}
+		m.onEnter[name] = append(m.onEnter[name], f)
+	}
+}
+
+// WithOnExit creates an Option that registers a hook to be run before the Machine
+// leaves the state with the given name. If the hook returns an error, the
+// transition is aborted.
+func WithOnExit(name string, f HookFunc) Option {
+	return func(m *Machine) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		if m.onExit == nil {
+			m.onExit = make(map[string][]HookFunc)
+		}
+		m.onExit[name] = append(m.onExit[name], f)
+	}
+}
+
+// WithOnTransition creates an Option that registers a hook to be run for every
+// transition, after the exit hooks and before the current state is changed.
+// If the hook returns an error, the transition is aborted.
+func WithOnTransition(f HookFunc) Option {
+	return func(m *Machine) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		m.onTransition = append(m.onTransition, f)
+	}
+}
+
+// runHooks calls each hook in order, stopping at the first error.
+func runHooks(ctx context.Context, hooks []HookFunc, value interface{}, from, to State, t Transition) error {
+	for _, f := range hooks {
+		if err := f(ctx, value, from, to, t); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
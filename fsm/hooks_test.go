@@ -0,0 +1,157 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestHooks(t *testing.T) {
+	isByte := func(want byte) TriggerFunc {
+		return func(_ context.Context, v interface{}) (bool, error) {
+			b, ok := v.(byte)
+			return ok && b == want, nil
+		}
+	}
+
+	t.Run("ordering", func(t *testing.T) {
+		s1 := NewState("STATE1")
+		s2 := NewState("STATE2")
+		t1 := s1.When("v == 'a'", isByte('a')).Then(s2)
+
+		var calls []string
+		record := func(name string) HookFunc {
+			return func(_ context.Context, v interface{}, from, to State, tr Transition) error {
+				if v.(byte) != 'a' || from.Id() != s1.Id() || to.Id() != s2.Id() || tr.Id() != t1.Id() {
+					t.Fatalf("%s: unexpected hook arguments", name)
+				}
+				calls = append(calls, name)
+				return nil
+			}
+		}
+
+		m := NewMachine(
+			WithTransitions(t1),
+			WithOnEnter("STATE2", record("enter 2")),
+			WithOnExit("STATE1", record("exit 1")),
+			WithOnTransition(record("transition 1")),
+			WithOnTransition(record("transition 2")),
+			WithOnEnter("STATE1", record("enter 1")),
+		)
+
+		changed, err := m.Update(context.Background(), byte('a'))
+		if err != nil {
+			t.Fatalf("unexpected error: %v", err)
+		}
+		if !changed {
+			t.Fatal("change expected")
+		}
+
+		expected := []string{"exit 1", "transition 1", "transition 2", "enter 2"}
+		if !reflect.DeepEqual(calls, expected) {
+			t.Fatalf("expected %v, got %v", expected, calls)
+		}
+	})
+
+	t.Run("no hooks on miss", func(t *testing.T) {
+		s1 := NewState("STATE1")
+		s2 := NewState("STATE2")
+
+		var called bool
+		m := NewMachine(
+			WithTransitions(s1.When("v == 'a'", isByte('a')).Then(s2)),
+			WithOnTransition(func(context.Context, interface{}, State, State, Transition) error {
+				called = true
+				return nil
+			}),
+		)
+
+		if changed, err := m.Update(context.Background(), byte('b')); changed || err != nil {
+			t.Fatalf("unexpected result: %v, %v", changed, err)
+		}
+		if called {
+			t.Fatal("unexpected hook call")
+		}
+	})
+
+	t.Run("exit error aborts", func(t *testing.T) {
+		s1 := NewState("STATE1")
+		s2 := NewState("STATE2")
+		errExit := errors.New("exit")
+
+		var entered bool
+		m := NewMachine(
+			WithTransitions(s1.When("v == 'a'", isByte('a')).Then(s2)),
+			WithOnExit("STATE1", func(context.Context, interface{}, State, State, Transition) error {
+				return errExit
+			}),
+			WithOnEnter("STATE2", func(context.Context, interface{}, State, State, Transition) error {
+				entered = true
+				return nil
+			}),
+		)
+
+		changed, err := m.Update(context.Background(), byte('a'))
+		if !errors.Is(err, errExit) {
+			t.Fatalf("expected exit error, got %v", err)
+		}
+		if changed {
+			t.Fatal("unexpected change")
+		}
+		if entered {
+			t.Fatal("unexpected enter hook call")
+		}
+		if m.Current().Id() != s1.Id() {
+			t.Fatal("expected STATE1")
+		}
+	})
+
+	t.Run("transition error aborts", func(t *testing.T) {
+		s1 := NewState("STATE1")
+		s2 := NewState("STATE2")
+		errTransition := errors.New("transition")
+
+		m := NewMachine(
+			WithTransitions(s1.When("v == 'a'", isByte('a')).Then(s2)),
+			WithOnTransition(func(context.Context, interface{}, State, State, Transition) error {
+				return errTransition
+			}),
+		)
+
+		changed, err := m.Update(context.Background(), byte('a'))
+		if !errors.Is(err, errTransition) {
+			t.Fatalf("expected transition error, got %v", err)
+		}
+		if changed {
+			t.Fatal("unexpected change")
+		}
+		if m.Current().Id() != s1.Id() {
+			t.Fatal("expected STATE1")
+		}
+	})
+
+	t.Run("enter error after change", func(t *testing.T) {
+		s1 := NewState("STATE1")
+		s2 := NewState("STATE2")
+		errEnter := errors.New("enter")
+
+		m := NewMachine(
+			WithTransitions(s1.When("v == 'a'", isByte('a')).Then(s2)),
+			WithOnEnter("STATE2", func(context.Context, interface{}, State, State, Transition) error {
+				return errEnter
+			}),
+		)
+
+		changed, err := m.Update(context.Background(), byte('a'))
+		if !errors.Is(err, errEnter) {
+			t.Fatalf("expected enter error, got %v", err)
+		}
+		if !changed {
+			t.Fatal("change expected")
+		}
+		if m.Current().Id() != s2.Id() {
+			t.Fatal("expected STATE2")
+		}
+	})
+}
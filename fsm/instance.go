@@ -0,0 +1,144 @@
+package fsm
+
+import (
+	"context"
+	"sync"
+)
+
+// Instance is a lightweight state machine created from a Definition. It only
+// holds its current state and the configuration remembered for history
+// pseudo-states; transitions, their index and the conflict policy are shared
+// with every other instance of the Definition. Creating an Instance allocates
+// a few words, which makes it suitable for running one machine per entity.
+//
+// Instances select and fire transitions exactly like a Machine created with
+// Definition.New, including hierarchical states, history pseudo-states and
+// transition actions. They do not run hooks, record history or start timers:
+// timed transitions never fire on an Instance. Use Definition.New where those
+// are needed. All operations are thread-safe.
+//
+// Example:
+//
+//	def, err := b.Build()
+//	if err != nil {
+//	    // handle error
+//	}
+//	orders := make(map[string]*fsm.Instance)
+//	for _, id := range ids {
+//	    orders[id] = def.Instance()
+//	}
+//	changed, err := orders["42"].Fire(ctx, "pay", payment)
+type Instance struct {
+	def  *Definition // Shared definition
+	mu   sync.Mutex  // Mutex for thread-safety
+	curr State       // Current state
+
+	shallow map[uint64]State // Map of state IDs to the child active when last exited, created on demand
+	deep    map[uint64]State // Map of state IDs to the innermost state active when last exited, created on demand
+}
+
+// Instance creates an Instance of the Definition in its start state.
+//
+// Example:
+//
+//	inst := def.Instance()
+func (d *Definition) Instance() *Instance {
+	return &Instance{def: d, curr: d.initial}
+}
+
+// InstanceAt creates an Instance of the Definition in the named state, such as
+// one loaded from a database. It returns an *UnknownStateError if the state is
+// not known to the Definition. Initial sub-states of the named state are
+// entered as for a transition that targets it.
+//
+// Example:
+//
+//	inst, err := def.InstanceAt(row.State)
+func (d *Definition) InstanceAt(name string) (*Instance, error) {
+	s, ok := d.states[name]
+	if !ok {
+		return nil, &UnknownStateError{Name: name}
+	}
+
+	return &Instance{def: d, curr: d.proto.resolve(origin(s))}, nil
+}
+
+// Current returns the current state of the Instance.
+func (i *Instance) Current() State {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	return i.curr
+}
+
+// IsEndState checks if the current state is one of the end states of the
+// Definition.
+func (i *Instance) IsEndState() bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	_, ok := i.def.proto.endStates[i.curr.Id()]
+	return ok
+}
+
+// Reset moves the Instance back to the start state of the Definition and
+// forgets the configuration remembered for history pseudo-states.
+func (i *Instance) Reset() {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	i.curr = i.def.initial
+	i.shallow, i.deep = nil, nil
+}
+
+// Update updates the state of the Instance based on the provided value.
+// See Machine.Update.
+//
+// Example:
+//
+//	changed, err := inst.Update(ctx, order)
+func (i *Instance) Update(ctx context.Context, value interface{}) (bool, error) {
+	return i.step(ctx, value, i.def.proto.unkeyed)
+}
+
+// Fire updates the state of the Instance in response to a named event.
+// See Machine.Fire.
+//
+// Example:
+//
+//	changed, err := inst.Fire(ctx, "pay", payment)
+func (i *Instance) Fire(ctx context.Context, trigger Trigger, payload interface{}) (bool, error) {
+	return i.step(ctx, payload, func(s State) []Transition {
+		return i.def.proto.events[s.Id()][trigger]
+	})
+}
+
+// step fires the transition chosen by the shared machine of the Definition
+// from the candidates of the current state and its ancestors.
+func (i *Instance) step(ctx context.Context, value interface{}, candidates func(State) []Transition) (bool, error) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	select {
+	case <-ctx.Done():
+		return false, ctx.Err()
+	default:
+	}
+
+	proto := i.def.proto
+	t, err := proto.next(ctx, value, i.curr, candidates)
+	if err != nil || t == nil {
+		return false, err
+	}
+
+	to := resolve(proto.initial, i.shallow, i.deep, t.To())
+	if err := t.Exec(ctx, value); err != nil {
+		return false, err
+	}
+
+	exited, _ := route(i.curr, to, t)
+	i.shallow, i.deep = remember(i.shallow, i.deep, i.curr, exited)
+	i.curr = to
+
+	return true, nil
+}
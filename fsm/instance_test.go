@@ -0,0 +1,242 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+)
+
+// mkOrderDefinition builds the definition used by the instance tests and benchmarks.
+func mkOrderDefinition(tb testing.TB, opts ...func(*Builder)) *Definition {
+	tb.Helper()
+
+	b := NewBuilder()
+	processing := b.State("PROCESSING")
+	b.State("VALIDATING", WithParent(processing), AsInitial())
+	b.State("CHARGING", WithParent(processing))
+	b.State("PAUSED")
+	b.State("DONE")
+	b.When("VALIDATING", "valid", func(_ context.Context, v interface{}) (bool, error) {
+		return v == "valid", nil
+	}).Then("CHARGING")
+	b.When("CHARGING", "charged", func(_ context.Context, v interface{}) (bool, error) {
+		return v == "charged", nil
+	}).Then("DONE")
+	b.On("PROCESSING", "pause").Then("PAUSED")
+	b.On("PAUSED", "resume").Then(b.HistoryOf("PROCESSING"))
+	b.On("DONE", "reopen").Then("PROCESSING")
+	b.End("DONE")
+	for _, f := range opts {
+		f(b)
+	}
+
+	def, err := b.Build()
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return def
+}
+
+func TestInstance(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("update and fire", func(t *testing.T) {
+		def := mkOrderDefinition(t)
+		inst, other := def.Instance(), def.Instance()
+		if inst.Current().Name() != "VALIDATING" {
+			t.Fatalf("expected VALIDATING, got %s", inst.Current().Name())
+		}
+
+		if changed, err := inst.Update(ctx, "valid"); !changed || err != nil {
+			t.Fatalf("unexpected result: %v, %v", changed, err)
+		}
+		for _, trigger := range []Trigger{"pause", "resume"} {
+			if _, err := inst.Fire(ctx, trigger, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if inst.Current().Name() != "CHARGING" {
+			t.Fatalf("expected history to restore CHARGING, got %s", inst.Current().Name())
+		}
+		if changed, err := inst.Update(ctx, "charged"); !changed || err != nil || !inst.IsEndState() {
+			t.Fatalf("unexpected result: %v, %v", changed, err)
+		}
+		if other.Current().Name() != "VALIDATING" {
+			t.Fatalf("expected instances to be independent, got %s", other.Current().Name())
+		}
+
+		inst.Reset()
+		if inst.Current().Name() != "VALIDATING" {
+			t.Fatalf("expected VALIDATING after Reset, got %s", inst.Current().Name())
+		}
+	})
+
+	t.Run("same as machine", func(t *testing.T) {
+		def := mkOrderDefinition(t)
+		inst, m := def.Instance(), def.New()
+		steps := []struct {
+			trigger Trigger
+			value   interface{}
+		}{
+			{"", "valid"}, {"pause", nil}, {"resume", nil}, {"", "nope"}, {"", "charged"}, {"reopen", nil},
+		}
+		for _, s := range steps {
+			var ichanged, mchanged bool
+			var ierr, merr error
+			if s.trigger != "" {
+				ichanged, ierr = inst.Fire(ctx, s.trigger, s.value)
+				mchanged, merr = m.Fire(ctx, s.trigger, s.value)
+			} else {
+				ichanged, ierr = inst.Update(ctx, s.value)
+				mchanged, merr = m.Update(ctx, s.value)
+			}
+			if ichanged != mchanged || ierr != merr || inst.Current().Id() != m.Current().Id() {
+				t.Fatalf("%v: instance %v, %v, %s; machine %v, %v, %s",
+					s, ichanged, ierr, inst.Current().Name(), mchanged, merr, m.Current().Name())
+			}
+		}
+	})
+
+	t.Run("instance at", func(t *testing.T) {
+		def := mkOrderDefinition(t)
+		inst, err := def.InstanceAt("PROCESSING")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if inst.Current().Name() != "VALIDATING" {
+			t.Fatalf("expected VALIDATING, got %s", inst.Current().Name())
+		}
+		if _, err := def.InstanceAt("SHIPPED"); !errors.Is(err, ErrUnknownState) {
+			t.Fatalf("expected ErrUnknownState, got %v", err)
+		}
+	})
+
+	t.Run("policy", func(t *testing.T) {
+		def := mkOrderDefinition(t, func(b *Builder) {
+			b.State("ESCALATED")
+			b.When("VALIDATING", "escalate", func(context.Context, interface{}) (bool, error) {
+				return true, nil
+			}).Then("ESCALATED")
+			b.End("ESCALATED")
+			b.Policy(Strict)
+		})
+		if _, err := def.Instance().Update(ctx, "valid"); !errors.Is(err, ErrAmbiguousTransition) {
+			t.Fatalf("expected ErrAmbiguousTransition, got %v", err)
+		}
+		if _, err := def.New().Update(ctx, "valid"); !errors.Is(err, ErrAmbiguousTransition) {
+			t.Fatalf("expected ErrAmbiguousTransition, got %v", err)
+		}
+	})
+
+	t.Run("action", func(t *testing.T) {
+		boom := errors.New("boom")
+		def := mkOrderDefinition(t, func(b *Builder) {
+			b.State("FAILED")
+			b.On("VALIDATING", "fail").Do(func(context.Context, interface{}) error { return boom }).Then("FAILED")
+			b.End("FAILED")
+		})
+		inst := def.Instance()
+		if changed, err := inst.Fire(ctx, "fail", nil); changed || !errors.Is(err, boom) {
+			t.Fatalf("unexpected result: %v, %v", changed, err)
+		}
+		if inst.Current().Name() != "VALIDATING" {
+			t.Fatalf("expected state to be unchanged, got %s", inst.Current().Name())
+		}
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		def := mkOrderDefinition(t)
+		var wg sync.WaitGroup
+		for n := 0; n < 8; n++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				inst := def.Instance()
+				for _, v := range []string{"valid", "charged"} {
+					if _, err := inst.Update(ctx, v); err != nil {
+						t.Error(err)
+					}
+				}
+				if inst.Current().Name() != "DONE" {
+					t.Errorf("expected DONE, got %s", inst.Current().Name())
+				}
+			}()
+		}
+		wg.Wait()
+	})
+}
+
+// sink keeps benchmarked instances on the heap.
+var sink *Instance
+
+func BenchmarkDefinitionInstance(b *testing.B) {
+	def := mkOrderDefinition(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		sink = def.Instance()
+	}
+}
+
+func BenchmarkDefinitionNew(b *testing.B) {
+	def := mkOrderDefinition(b)
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		def.New().Stop()
+	}
+}
+
+func BenchmarkInstanceUpdate(b *testing.B) {
+	def := mkOrderDefinition(b)
+	inst := def.Instance()
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		if _, err := inst.Update(ctx, "valid"); err != nil {
+			b.Fatal(err)
+		}
+		inst.Reset()
+	}
+}
+
+func BenchmarkMachineUpdate(b *testing.B) {
+	def := mkOrderDefinition(b)
+	m := def.New()
+	defer m.Stop()
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	for n := 0; n < b.N; n++ {
+		if _, err := m.Update(ctx, "valid"); err != nil {
+			b.Fatal(err)
+		}
+		if err := m.Reset(); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkInstanceUpdateParallel(b *testing.B) {
+	def := mkOrderDefinition(b)
+	ctx := context.Background()
+	b.ReportAllocs()
+	b.ResetTimer()
+
+	b.RunParallel(func(pb *testing.PB) {
+		inst := def.Instance()
+		for pb.Next() {
+			if _, err := inst.Update(ctx, "valid"); err != nil {
+				b.Error(err)
+				return
+			}
+			inst.Reset()
+		}
+	})
+}
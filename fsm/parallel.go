@@ -0,0 +1,288 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+// Parallel is a composite state machine made of independent regions.
+// Each region is a Machine of its own; Update and Fire are dispatched to every
+// region, and the combination of their current states forms the configuration
+// of the Parallel machine. All operations on a Parallel machine are thread-safe,
+// and an Update or Fire is applied to all regions before the configuration can
+// be observed.
+type Parallel struct {
+	mu      sync.RWMutex // Mutex for thread-safety
+	regions []region     // Regions in the order they were added
+	err     error        // First error found while adding regions
+}
+
+// region is a named sub-machine of a Parallel machine.
+type region struct {
+	name string
+	m    *Machine
+}
+
+// ParallelOption is a function type used to configure a Parallel machine.
+type ParallelOption func(*Parallel)
+
+// WithRegion creates a ParallelOption that adds the Machine as a region with
+// the given name. Regions receive events in the order they were added.
+// A region with an empty name or a nil Machine is not added; the error is
+// returned by Validate, Update and Fire.
+//
+// Example:
+//
+//	p := fsm.NewParallel(
+//		fsm.WithRegion("payment", payment),
+//		fsm.WithRegion("shipping", shipping),
+//	)
+func WithRegion(name string, m *Machine) ParallelOption {
+	return func(p *Parallel) {
+		p.mu.Lock()
+		defer p.mu.Unlock()
+
+		switch {
+		case name == "":
+			p.fail(errors.New("region has no name"))
+		case m == nil:
+			p.fail(fmt.Errorf("region '%s': no machine", name))
+		default:
+			p.regions = append(p.regions, region{name: name, m: m})
+		}
+	}
+}
+
+// fail records err unless an error was already recorded. The caller must hold p.mu.
+func (p *Parallel) fail(err error) {
+	if p.err == nil {
+		p.err = err
+	}
+}
+
+// NewParallel creates a new Parallel machine with the provided options.
+//
+// Example:
+//
+//	p := fsm.NewParallel(
+//		fsm.WithRegion("payment", payment),
+//		fsm.WithRegion("shipping", shipping),
+//	)
+//	if err := p.Validate(); err != nil {
+//	    // Handle invalid configuration
+//	}
+func NewParallel(opts ...ParallelOption) *Parallel {
+	p := &Parallel{}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p
+}
+
+// Region returns the Machine of the region with the given name, or nil if
+// there is no such region.
+func (p *Parallel) Region(name string) *Machine {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, r := range p.regions {
+		if r.name == name {
+			return r.m
+		}
+	}
+
+	return nil
+}
+
+// Regions returns the names of all regions, in the order they were added.
+func (p *Parallel) Regions() []string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	names := make([]string, len(p.regions))
+	for i, r := range p.regions {
+		names[i] = r.name
+	}
+
+	return names
+}
+
+// Validate checks that every region was added, that the Parallel machine has
+// at least one region, that region names are unique, and that every region is
+// a valid Machine. Errors from a region are prefixed with the region name.
+func (p *Parallel) Validate() error {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if p.err != nil {
+		return p.err
+	}
+	if len(p.regions) == 0 {
+		return errors.New("parallel machine has no regions")
+	}
+
+	seen := make(map[string]bool, len(p.regions))
+	for _, r := range p.regions {
+		if seen[r.name] {
+			return fmt.Errorf("duplicate region: '%s'", r.name)
+		}
+		seen[r.name] = true
+
+		if err := r.m.Validate(); err != nil {
+			return fmt.Errorf("region '%s': %w", r.name, err)
+		}
+	}
+
+	return nil
+}
+
+// Update dispatches the value to every region (see Machine.Update).
+// All regions receive the value even if one of them fails.
+//
+// Returns:
+// - bool: true if the state of any region changed, false otherwise
+// - error: the first error returned by a region, prefixed with its name
+//
+// Example:
+//
+//	changed, err := p.Update(ctx, event)
+func (p *Parallel) Update(ctx context.Context, value interface{}) (bool, error) {
+	return p.dispatch(func(m *Machine) (bool, error) {
+		return m.Update(ctx, value)
+	})
+}
+
+// Fire dispatches the named event to every region (see Machine.Fire).
+// Regions without a matching transition are left unchanged. All regions
+// receive the event even if one of them fails.
+//
+// Returns:
+// - bool: true if the state of any region changed, false otherwise
+// - error: the first error returned by a region, prefixed with its name
+//
+// Example:
+//
+//	changed, err := p.Fire(ctx, "cancel", nil)
+func (p *Parallel) Fire(ctx context.Context, trigger Trigger, payload interface{}) (bool, error) {
+	return p.dispatch(func(m *Machine) (bool, error) {
+		return m.Fire(ctx, trigger, payload)
+	})
+}
+
+// dispatch calls f for every region in order. Completed regions (see
+// WithTerminalEndStates) are left unchanged without failing the dispatch.
+// Nothing is dispatched if a region could not be added.
+func (p *Parallel) dispatch(f func(*Machine) (bool, error)) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.err != nil {
+		return false, p.err
+	}
+
+	var (
+		changed  bool
+		firstErr error
+	)
+	for _, r := range p.regions {
+		ok, err := f(r.m)
+		changed = changed || ok
+		if errors.Is(err, ErrTerminalState) {
+			continue
+		}
+		if err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("region '%s': %w", r.name, err)
+		}
+	}
+
+	return changed, firstErr
+}
+
+// Configuration returns the name of the current state of every region, keyed
+// by region name. Regions without a current state are omitted.
+//
+// Example:
+//
+//	cfg := p.Configuration() // map[payment:PAID shipping:PACKING]
+func (p *Parallel) Configuration() map[string]string {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	cfg := make(map[string]string, len(p.regions))
+	for _, r := range p.regions {
+		if curr := r.m.Current(); curr != nil {
+			cfg[r.name] = curr.Name()
+		}
+	}
+
+	return cfg
+}
+
+// In reports whether the region with the given name is in the named state.
+//
+// Example:
+//
+//	if p.In("payment", "PAID") && p.In("shipping", "PACKING") {
+//	    // ...
+//	}
+func (p *Parallel) In(regionName, stateName string) bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	for _, r := range p.regions {
+		if r.name == regionName {
+			curr := r.m.Current()
+			return curr != nil && curr.Name() == stateName
+		}
+	}
+
+	return false
+}
+
+// IsEndState reports whether every region is in one of its end states.
+// A Parallel machine without regions is never in an end state.
+func (p *Parallel) IsEndState() bool {
+	p.mu.RLock()
+	defer p.mu.RUnlock()
+
+	if len(p.regions) == 0 {
+		return false
+	}
+	for _, r := range p.regions {
+		if !r.m.IsEndState() {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Stop stops the timers of every region (see Machine.Stop).
+func (p *Parallel) Stop() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for _, r := range p.regions {
+		r.m.Stop()
+	}
+}
+
+// Reset resets every region to its start state (see Machine.Reset).
+// It returns the first error, prefixed with the region name; the remaining
+// regions are still reset.
+func (p *Parallel) Reset() error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var firstErr error
+	for _, r := range p.regions {
+		if err := r.m.Reset(); err != nil && firstErr == nil {
+			firstErr = fmt.Errorf("region '%s': %w", r.name, err)
+		}
+	}
+
+	return firstErr
+}
@@ -0,0 +1,161 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestParallel(t *testing.T) {
+	mkParallel := func(t *testing.T) *Parallel {
+		t.Helper()
+
+		unpaid, paid, refunded := NewState("UNPAID"), NewState("PAID"), NewState("REFUNDED")
+		payment := NewMachine(WithTransitions(
+			unpaid.When("paid", is("pay")).Then(paid),
+			paid.On("cancel").Then(refunded),
+		))
+		if err := payment.SetEndStates("PAID", "REFUNDED"); err != nil {
+			t.Fatal(err)
+		}
+
+		packing, shipped, returned := NewState("PACKING"), NewState("SHIPPED"), NewState("RETURNED")
+		shipping := NewMachine(WithTransitions(
+			packing.When("shipped", is("ship")).Then(shipped),
+			packing.On("cancel").Then(returned),
+		))
+		if err := shipping.SetEndStates("SHIPPED", "RETURNED"); err != nil {
+			t.Fatal(err)
+		}
+
+		p := NewParallel(WithRegion("payment", payment), WithRegion("shipping", shipping))
+		if err := p.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	t.Run("update", func(t *testing.T) {
+		p := mkParallel(t)
+		ctx := context.Background()
+
+		want := map[string]string{"payment": "UNPAID", "shipping": "PACKING"}
+		if cfg := p.Configuration(); !reflect.DeepEqual(cfg, want) {
+			t.Fatalf("expected %v, got %v", want, cfg)
+		}
+
+		if changed, err := p.Update(ctx, "pay"); !changed || err != nil {
+			t.Fatalf("unexpected result: %v, %v", changed, err)
+		}
+		if !p.In("payment", "PAID") || !p.In("shipping", "PACKING") {
+			t.Fatalf("unexpected configuration: %v", p.Configuration())
+		}
+		if p.IsEndState() {
+			t.Fatal("expected shipping to be unfinished")
+		}
+
+		if changed, err := p.Update(ctx, "ship"); !changed || err != nil {
+			t.Fatalf("unexpected result: %v, %v", changed, err)
+		}
+		if !p.IsEndState() {
+			t.Fatalf("expected end state, got %v", p.Configuration())
+		}
+		if changed, err := p.Update(ctx, "nothing"); changed || err != nil {
+			t.Fatalf("unexpected result: %v, %v", changed, err)
+		}
+	})
+
+	t.Run("fire", func(t *testing.T) {
+		p := mkParallel(t)
+		ctx := context.Background()
+
+		if _, err := p.Update(ctx, "pay"); err != nil {
+			t.Fatal(err)
+		}
+		if changed, err := p.Fire(ctx, "cancel", nil); !changed || err != nil {
+			t.Fatalf("unexpected result: %v, %v", changed, err)
+		}
+		want := map[string]string{"payment": "REFUNDED", "shipping": "RETURNED"}
+		if cfg := p.Configuration(); !reflect.DeepEqual(cfg, want) {
+			t.Fatalf("expected %v, got %v", want, cfg)
+		}
+
+		if err := p.Reset(); err != nil {
+			t.Fatal(err)
+		}
+		if !p.In("payment", "UNPAID") || !p.In("shipping", "PACKING") {
+			t.Fatalf("unexpected configuration after reset: %v", p.Configuration())
+		}
+	})
+
+	t.Run("region error", func(t *testing.T) {
+		a, b := NewState("A"), NewState("B")
+		failing := NewMachine(WithTransitions(a.When("fail", func(context.Context, interface{}) (bool, error) {
+			return false, errors.New("boom")
+		}).Then(b)))
+		c, d := NewState("C"), NewState("D")
+		ok := NewMachine(WithTransitions(c.When("go", is("go")).Then(d)))
+
+		p := NewParallel(WithRegion("failing", failing), WithRegion("ok", ok))
+		changed, err := p.Update(context.Background(), "go")
+		if err == nil || !strings.Contains(err.Error(), "region 'failing': guard 'fail' failed: boom") {
+			t.Fatalf("expected region error, got %v", err)
+		}
+		if !changed || !p.In("ok", "D") {
+			t.Fatal("expected the other region to be updated")
+		}
+		if p.Region("ok") != ok || p.Region("missing") != nil {
+			t.Fatal("unexpected region lookup")
+		}
+	})
+
+	t.Run("validate", func(t *testing.T) {
+		a, b := NewState("A"), NewState("B")
+		m := NewMachine(WithTransitions(a.When("go", is("go")).Then(b)))
+		if err := m.SetEndStates("B"); err != nil {
+			t.Fatal(err)
+		}
+
+		tests := []struct {
+			name    string
+			p       *Parallel
+			wantErr string
+		}{
+			{"no regions", NewParallel(), "no regions"},
+			{"duplicate", NewParallel(WithRegion("x", m), WithRegion("x", m)), "duplicate region: 'x'"},
+			{"nil machine", NewParallel(WithRegion("x", nil)), "region 'x': no machine"},
+			{"no name", NewParallel(WithRegion("", m)), "region has no name"},
+			{"invalid region", NewParallel(WithRegion("x", NewMachine())), "region 'x': no start state set"},
+		}
+		for _, tt := range tests {
+			t.Run(tt.name, func(t *testing.T) {
+				err := tt.p.Validate()
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+				}
+			})
+		}
+	})
+
+	t.Run("rejected region", func(t *testing.T) {
+		a, b := NewState("A"), NewState("B")
+		m := NewMachine(WithTransitions(a.When("go", is("go")).Then(b)))
+		p := NewParallel(WithRegion("ok", m), WithRegion("missing", nil))
+
+		changed, err := p.Update(context.Background(), "go")
+		if changed || err == nil || !strings.Contains(err.Error(), "region 'missing': no machine") {
+			t.Fatalf("unexpected result: %v, %v", changed, err)
+		}
+		if _, err := p.Fire(context.Background(), "go", nil); err == nil {
+			t.Fatal("expected an error")
+		}
+		if got := p.Configuration(); len(got) != 1 || got["ok"] != "A" {
+			t.Fatalf("unexpected configuration: %v", got)
+		}
+		if p.Region("missing") != nil {
+			t.Fatal("expected the region not to be added")
+		}
+	})
+}
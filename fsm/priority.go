@@ -0,0 +1,132 @@
+package fsm
+
+import (
+	"context"
+	"sort"
+)
+
+// ConflictPolicy determines which transition fires when the guards of more
+// than one transition from the same state pass.
+type ConflictPolicy int
+
+const (
+	// FirstMatch fires the first transition whose guard passes, in the order
+	// the transitions were added. Guards after it are not evaluated.
+	FirstMatch ConflictPolicy = iota
+	// HighestPriority evaluates guards in order of descending priority (see
+	// Transition.Prioritize), falling back to the order the transitions were
+	// added, and fires the first one that passes.
+	HighestPriority
+	// Strict evaluates every guard and fires the only transition whose guard
+	// passes. If more than one passes, nothing fires and an
+	// *AmbiguousTransitionError is returned.
+	Strict
+)
+
+// WithConflictPolicy creates an Option that sets how the Machine chooses
+// between transitions from the same state whose guards pass. The default is
+// FirstMatch. Transitions of the current state always take precedence over
+// those of its parent states; the policy applies to each state in turn.
+//
+// Example:
+//
+//	m := fsm.NewMachine(fsm.WithTransitions(t1, t2), fsm.WithConflictPolicy(fsm.Strict))
+func WithConflictPolicy(p ConflictPolicy) Option {
+	return func(m *Machine) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		m.policy = p
+	}
+}
+
+// step fires the transition chosen from the candidates of curr and its
+// ancestors, innermost first. candidates returns the transitions of a state
+// that may fire. The caller must hold m.mu.
+func (m *Machine) step(ctx context.Context, value interface{}, curr State, candidates func(State) []Transition) (bool, error) {
+	t, err := m.next(ctx, value, curr, candidates)
+	if err != nil || t == nil {
+		return false, err
+	}
+
+	return m.commit(ctx, value, curr, t)
+}
+
+// next returns the transition chosen from the candidates of curr and its
+// ancestors, innermost first, or nil if none can fire. It only reads the
+// transitions and policy of the Machine, so it can be shared by the instances
+// of a Definition. The caller must hold m.mu, unless the Machine is read-only.
+func (m *Machine) next(ctx context.Context, value interface{}, curr State, candidates func(State) []Transition) (Transition, error) {
+	for _, s := range ancestry(curr) {
+		t, _, err := m.choose(ctx, value, s, candidates(s), false)
+		if err != nil || t != nil {
+			return t, err
+		}
+	}
+
+	return nil, nil
+}
+
+// choose evaluates the guards of the transitions from s according to the
+// Machine's ConflictPolicy and returns the transition to fire, or nil.
+// Unless all is set, it stops at the guard that decides the result. If all is
+// set, the remaining guards are evaluated as well, and the transitions whose
+// guards passed are returned in the order they were added; errors of guards
+// that would not have been evaluated otherwise are ignored, so that the result
+// is the same either way. The caller must hold m.mu.
+func (m *Machine) choose(ctx context.Context, value interface{}, s State, transitions []Transition, all bool) (Transition, []Transition, error) {
+	ordered := transitions
+	if m.policy == HighestPriority {
+		ordered = make([]Transition, len(transitions))
+		copy(ordered, transitions)
+		sort.SliceStable(ordered, func(i, j int) bool {
+			return ordered[i].Priority() > ordered[j].Priority()
+		})
+	}
+
+	var selected Transition
+	var passed []Transition
+	for _, t := range ordered {
+		ok, err := guard(ctx, t, value)
+		if err != nil {
+			if selected != nil && m.policy != Strict {
+				continue
+			}
+			return nil, nil, err
+		}
+		if !ok {
+			continue
+		}
+		if !all && m.policy != Strict {
+			return t, nil, nil
+		}
+		if selected == nil {
+			selected = t
+		}
+		passed = append(passed, t)
+	}
+
+	var matched []Transition
+	for _, t := range transitions {
+		for _, p := range passed {
+			if t == p {
+				matched = append(matched, t)
+				break
+			}
+		}
+	}
+	if m.policy == Strict && len(matched) > 1 {
+		return nil, matched, &AmbiguousTransitionError{State: s.Name(), Transitions: matched}
+	}
+
+	return selected, matched, nil
+}
+
+// guard evaluates the guard of t, wrapping any error in a *GuardError.
+func guard(ctx context.Context, t Transition, value interface{}) (bool, error) {
+	ok, err := t.Go(ctx, value)
+	if err != nil {
+		return false, &GuardError{TransitionID: t.Id(), Description: t.Description(), Err: err}
+	}
+	return ok, nil
+}
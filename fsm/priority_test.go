@@ -0,0 +1,113 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestConflictPolicy(t *testing.T) {
+	always := func(context.Context, interface{}) (bool, error) { return true, nil }
+	never := func(context.Context, interface{}) (bool, error) { return false, nil }
+
+	mkMachine := func(opts ...Option) *Machine {
+		start := NewState("START")
+		return NewMachine(append([]Option{WithTransitions(
+			start.When("low", always).Prioritize(-1).Then(NewState("LOW")),
+			start.When("default", always).Then(NewState("DEFAULT")),
+			start.When("high", always).Prioritize(10).Then(NewState("HIGH")),
+			start.When("never", never).Prioritize(20).Then(NewState("NEVER")),
+			start.When("also high", always).Prioritize(10).Then(NewState("ALSO_HIGH")),
+			start.On("go").Then(NewState("GO")),
+		)}, opts...)...)
+	}
+
+	tests := []struct {
+		name   string
+		policy ConflictPolicy
+		want   string
+	}{
+		{"first match", FirstMatch, "LOW"},
+		{"highest priority", HighestPriority, "HIGH"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := mkMachine(WithConflictPolicy(tt.policy))
+			if changed, err := m.Update(context.Background(), nil); !changed || err != nil {
+				t.Fatalf("unexpected result: %v, %v", changed, err)
+			}
+			if m.Current().Name() != tt.want {
+				t.Fatalf("expected %s, got %s", tt.want, m.Current().Name())
+			}
+		})
+	}
+
+	t.Run("strict", func(t *testing.T) {
+		m := mkMachine(WithConflictPolicy(Strict))
+		changed, err := m.Update(context.Background(), nil)
+		if changed || !errors.Is(err, ErrAmbiguousTransition) {
+			t.Fatalf("expected ambiguous transition, got %v, %v", changed, err)
+		}
+
+		var ambiguous *AmbiguousTransitionError
+		if !errors.As(err, &ambiguous) {
+			t.Fatalf("expected *AmbiguousTransitionError, got %T", err)
+		}
+		if ambiguous.State != "START" || len(ambiguous.Transitions) != 4 {
+			t.Fatalf("unexpected error: %+v", ambiguous)
+		}
+		if !strings.Contains(err.Error(), "'low', 'default', 'high', 'also high'") {
+			t.Fatalf("unexpected message: %s", err.Error())
+		}
+		if m.Current().Name() != "START" {
+			t.Fatalf("expected START, got %s", m.Current().Name())
+		}
+
+		// a single passing guard is not ambiguous
+		if changed, err := m.Fire(context.Background(), "go", nil); !changed || err != nil {
+			t.Fatalf("unexpected result: %v, %v", changed, err)
+		}
+	})
+
+	t.Run("inner state first", func(t *testing.T) {
+		parent := NewState("PARENT")
+		child := NewState("CHILD", WithParent(parent), AsInitial())
+		m := NewMachine(
+			WithConflictPolicy(Strict),
+			WithTransitions(
+				parent.When("parent", always).Prioritize(100).Then(NewState("OUTER")),
+				parent.When("parent too", always).Then(NewState("OUTER_TOO")),
+				child.When("child", always).Then(NewState("INNER")),
+			),
+		)
+		if _, err := m.Update(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if m.Current().Name() != "INNER" {
+			t.Fatalf("expected INNER, got %s", m.Current().Name())
+		}
+	})
+
+	t.Run("spec", func(t *testing.T) {
+		const doc = `{
+			"states": ["A", "B", "C"],
+			"end": ["B", "C"],
+			"transitions": [
+				{"from": "A", "to": "B", "guard": "always"},
+				{"from": "A", "to": "C", "guard": "always", "description": "preferred", "priority": 1}
+			]
+		}`
+		m, err := LoadSpec(strings.NewReader(doc), Registry{Guards: map[string]TriggerFunc{"always": always}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		WithConflictPolicy(HighestPriority)(m)
+		if _, err := m.Update(context.Background(), nil); err != nil {
+			t.Fatal(err)
+		}
+		if m.Current().Name() != "C" {
+			t.Fatalf("expected C, got %s", m.Current().Name())
+		}
+	})
+}
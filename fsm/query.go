@@ -0,0 +1,117 @@
+package fsm
+
+import (
+	"context"
+)
+
+// Evaluation describes what Update or Fire would do for a given value,
+// as reported by Evaluate and EvaluateEvent.
+type Evaluation struct {
+	Matched  []Transition // Transitions whose guards passed, innermost state first, in registration order, up to the state of Selected
+	Selected Transition   // Transition that would fire, or nil
+	Target   State        // State that would become current, or nil
+}
+
+// Available returns the outgoing transitions of the current state, including
+// those inherited from its parent states, innermost state first and in the
+// order they were added. Guards are not evaluated. Transitions keyed by an
+// event or a timeout are included; use Transition.Trigger and
+// Transition.Timeout to tell them apart.
+//
+// Example:
+//
+//	ts, err := m.Available(ctx)
+//	for _, t := range ts {
+//	    if t.Trigger() != "" {
+//	        enableButton(string(t.Trigger()))
+//	    }
+//	}
+func (m *Machine) Available(ctx context.Context) ([]Transition, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	curr, err := m.active(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	var out []Transition
+	for _, s := range ancestry(curr) {
+		out = append(out, m.transitions[s.Id()]...)
+	}
+
+	return out, nil
+}
+
+// Evaluate reports which transitions Update would consider for value, which
+// one it would fire and where the Machine would end up, without changing the
+// Machine. The guards of the current state and its ancestors are evaluated up
+// to the first state that selects a transition, as Update does, but every
+// guard of that state is evaluated; no hooks or actions are run and no history
+// is recorded. Under the Strict policy, an ambiguous result is returned along
+// with an *AmbiguousTransitionError. Evaluate only takes a read lock, so guards
+// may run concurrently with other queries.
+//
+// Example:
+//
+//	ev, err := m.Evaluate(ctx, order)
+//	if err == nil && ev.Selected != nil {
+//	    fmt.Println("would move to", ev.Target.Name())
+//	}
+func (m *Machine) Evaluate(ctx context.Context, value interface{}) (Evaluation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	curr, err := m.active(ctx)
+	if err != nil {
+		return Evaluation{}, err
+	}
+
+	return m.evaluate(ctx, value, curr, m.unkeyed)
+}
+
+// EvaluateEvent is the counterpart of Evaluate for Fire: it reports what firing
+// the named event with the payload would do, without changing the Machine.
+//
+// Example:
+//
+//	ev, err := m.EvaluateEvent(ctx, "pay", payment)
+//	payButton.Enabled = err == nil && ev.Selected != nil
+func (m *Machine) EvaluateEvent(ctx context.Context, trigger Trigger, payload interface{}) (Evaluation, error) {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	curr, err := m.active(ctx)
+	if err != nil {
+		return Evaluation{}, err
+	}
+
+	return m.evaluate(ctx, payload, curr, func(s State) []Transition {
+		return m.events[s.Id()][trigger]
+	})
+}
+
+// evaluate runs the guards of the candidates of curr and its ancestors,
+// innermost first, and selects a transition exactly as next does, stopping at
+// the first state that selects one. The caller must hold m.mu.
+func (m *Machine) evaluate(ctx context.Context, value interface{}, curr State, candidates func(State) []Transition) (Evaluation, error) {
+	var ev Evaluation
+
+	for _, s := range ancestry(curr) {
+		t, matched, err := m.choose(ctx, value, s, candidates(s), true)
+		ev.Matched = append(ev.Matched, matched...)
+		if _, ambiguous := err.(*AmbiguousTransitionError); ambiguous {
+			return ev, err
+		}
+		if err != nil {
+			return Evaluation{}, err
+		}
+		if t != nil {
+			ev.Selected = t
+			ev.Target = m.resolve(t.To())
+			break
+		}
+	}
+
+	return ev, nil
+}
@@ -0,0 +1,177 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	isNumber := func(_ context.Context, v interface{}) (bool, error) {
+		_, ok := v.(int)
+		return ok, nil
+	}
+	isPositive := func(_ context.Context, v interface{}) (bool, error) {
+		n, _ := v.(int)
+		return n > 0, nil
+	}
+
+	mkMachine := func(opts ...Option) (*Machine, *int) {
+		processing := NewState("PROCESSING")
+		counting := NewState("COUNTING", WithParent(processing), AsInitial())
+		done := NewState("DONE")
+		cancelled := NewState("CANCELLED")
+		positive := NewState("POSITIVE")
+
+		var actions int
+		m := NewMachine(append([]Option{
+			WithHistory(10),
+			WithTransitions(
+				counting.When("number", isNumber).Do(func(context.Context, interface{}) error {
+					actions++
+					return nil
+				}).Then(done),
+				counting.When("positive", isPositive).Prioritize(1).Then(positive),
+				processing.On("cancel").Then(cancelled),
+				processing.When("any", func(context.Context, interface{}) (bool, error) {
+					return true, nil
+				}).Then(cancelled),
+			),
+			WithOnEnter("DONE", func(context.Context, interface{}, State, State, Transition) error {
+				actions++
+				return nil
+			}),
+		}, opts...)...)
+		return m, &actions
+	}
+
+	descs := func(ts []Transition) []string {
+		out := make([]string, len(ts))
+		for i, t := range ts {
+			out[i] = t.Description()
+		}
+		return out
+	}
+
+	t.Run("available", func(t *testing.T) {
+		m, _ := mkMachine()
+		ts, err := m.Available(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := []string{"number", "positive", "cancel", "any"}
+		if got := descs(ts); !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("evaluate", func(t *testing.T) {
+		m, actions := mkMachine()
+		ev, err := m.Evaluate(context.Background(), 5)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := []string{"number", "positive"}; !reflect.DeepEqual(descs(ev.Matched), want) || ev.Selected.Description() != "number" || ev.Target.Name() != "DONE" {
+			t.Fatalf("unexpected evaluation: %v, %+v", descs(ev.Matched), ev)
+		}
+		if m.Current().Name() != "COUNTING" || *actions != 0 || len(m.History()) != 0 {
+			t.Fatal("expected no side effects")
+		}
+
+		WithConflictPolicy(HighestPriority)(m)
+		if ev, _ := m.Evaluate(context.Background(), 5); ev.Target.Name() != "POSITIVE" {
+			t.Fatalf("expected POSITIVE, got %v", ev.Target)
+		}
+		if ev, _ := m.Evaluate(context.Background(), "x"); ev.Target.Name() != "CANCELLED" {
+			t.Fatalf("expected inherited transition, got %v", ev.Target)
+		}
+
+		WithConflictPolicy(Strict)(m)
+		ev, err = m.Evaluate(context.Background(), 5)
+		if !errors.Is(err, ErrAmbiguousTransition) || ev.Selected != nil || len(ev.Matched) != 2 {
+			t.Fatalf("expected ambiguous evaluation, got %+v, %v", ev, err)
+		}
+	})
+
+	t.Run("evaluate event", func(t *testing.T) {
+		m, _ := mkMachine()
+		ev, err := m.EvaluateEvent(context.Background(), "cancel", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if ev.Target == nil || ev.Target.Name() != "CANCELLED" {
+			t.Fatalf("unexpected evaluation: %+v", ev)
+		}
+		if ev, _ := m.EvaluateEvent(context.Background(), "pay", nil); ev.Selected != nil || ev.Target != nil {
+			t.Fatalf("unexpected evaluation: %+v", ev)
+		}
+		if m.Current().Name() != "COUNTING" {
+			t.Fatal("expected no state change")
+		}
+	})
+
+	t.Run("same as update", func(t *testing.T) {
+		boom := errors.New("boom")
+		failing := func(context.Context, interface{}) (bool, error) {
+			return false, boom
+		}
+		for _, p := range []ConflictPolicy{FirstMatch, HighestPriority, Strict} {
+			parent := NewState("PARENT")
+			a := NewState("A", WithParent(parent), AsInitial())
+			b := NewState("B")
+			m := NewMachine(WithConflictPolicy(p), WithTransitions(
+				a.When("number", isNumber).Prioritize(1).Then(b),
+				a.When("failing", failing).Then(b),
+				parent.When("failing", failing).Then(b),
+			))
+
+			ev, err := m.Evaluate(context.Background(), 5)
+			if p == Strict {
+				if !errors.Is(err, boom) {
+					t.Fatalf("%v: expected guard error, got %+v, %v", p, ev, err)
+				}
+			} else if err != nil || ev.Selected == nil || len(ev.Matched) != 1 {
+				t.Fatalf("%v: expected guard errors after the selection to be ignored, got %+v, %v", p, ev, err)
+			}
+
+			changed, uerr := m.Update(context.Background(), 5)
+			if (uerr == nil) != (err == nil) || changed != (err == nil) {
+				t.Fatalf("%v: Update returned %v, %v; Evaluate returned %v", p, changed, uerr, err)
+			}
+		}
+	})
+
+	t.Run("history target", func(t *testing.T) {
+		parent := NewState("PARENT")
+		a := NewState("A", WithParent(parent), AsInitial())
+		b := NewState("B", WithParent(parent))
+		out := NewState("OUT")
+		m := NewMachine(WithTransitions(
+			a.On("next").Then(b),
+			parent.On("leave").Then(out),
+			out.On("back").Then(HistoryOf(parent)),
+		))
+		for _, trigger := range []Trigger{"next", "leave"} {
+			if _, err := m.Fire(context.Background(), trigger, nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+		ev, err := m.EvaluateEvent(context.Background(), "back", nil)
+		if err != nil || ev.Target.Name() != "B" {
+			t.Fatalf("unexpected evaluation: %+v, %v", ev, err)
+		}
+	})
+
+	t.Run("context", func(t *testing.T) {
+		m, _ := mkMachine()
+		ctx, cancel := context.WithCancel(context.Background())
+		cancel()
+		if _, err := m.Available(ctx); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context error, got %v", err)
+		}
+		if _, err := m.Evaluate(ctx, 1); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context error, got %v", err)
+		}
+	})
+}
@@ -0,0 +1,229 @@
+package fsm
+
+import (
+	"context"
+)
+
+// DefaultQueueSize is the capacity of the event queue of a Machine created
+// without WithQueue.
+const DefaultQueueSize = 64
+
+// Event is a unit of work sent to the run loop of a Machine with Send.
+type Event struct {
+	Trigger Trigger     // Event passed to Fire; if empty, Value is passed to Update instead
+	Value   interface{} // Payload passed to Fire, or value passed to Update
+}
+
+// OverflowPolicy determines what Send does when the event queue is full.
+type OverflowPolicy int
+
+const (
+	// OverflowBlock makes Send wait until there is room in the queue or its
+	// context is done.
+	OverflowBlock OverflowPolicy = iota
+	// OverflowDrop makes Send discard the event and return nil.
+	OverflowDrop
+	// OverflowError makes Send discard the event and return ErrQueueFull.
+	OverflowError
+)
+
+// queued is an event waiting in the queue, along with the context it was sent with.
+type queued struct {
+	ctx context.Context
+	e   Event
+}
+
+// runLoop is a run loop started by Run.
+type runLoop struct {
+	ctx    context.Context // Context the loop runs until
+	exited chan struct{}   // Closed once the loop has returned
+}
+
+// runKey is the context key that marks contexts passed to Update and Fire by
+// the run loop. Its value is the Machine running the loop.
+type runKey struct{}
+
+// WithQueue creates an Option that sets the capacity of the event queue used
+// by Send and Run, and what Send does when it is full. A negative size is
+// treated as zero, in which case every Send waits for the run loop.
+//
+// Example:
+//
+//	m := fsm.NewMachine(
+//		fsm.WithTransitions(t1, t2),
+//		fsm.WithQueue(1024, fsm.OverflowError),
+//	)
+func WithQueue(size int, policy OverflowPolicy) Option {
+	return func(m *Machine) {
+		m.qmu.Lock()
+		defer m.qmu.Unlock()
+
+		if size < 0 {
+			size = 0
+		}
+		m.inbox = make(chan queued, size)
+		m.overflow = policy
+	}
+}
+
+// Run starts the run loop of the Machine in a new goroutine and returns
+// immediately. The loop takes events queued with Send one at a time and passes
+// them to Fire or Update, so each event runs to completion before the next one
+// is started. Errors are passed to the function set with WithErrorHandler.
+// The loop stops when ctx is done; calling Run while a loop is already
+// running has no effect. Once its context is done, Run starts a new loop, which
+// waits for the previous one to return before taking events.
+//
+// Example:
+//
+//	m.Run(ctx)
+//	if err := m.Send(ctx, fsm.Event{Trigger: "pay", Value: payment}); err != nil {
+//	    // handle error
+//	}
+func (m *Machine) Run(ctx context.Context) {
+	inbox := m.queue()
+
+	m.qmu.Lock()
+	prev := m.loop
+	if prev != nil && prev.ctx.Err() == nil {
+		m.qmu.Unlock()
+		return
+	}
+	l := &runLoop{ctx: ctx, exited: make(chan struct{})}
+	m.loop = l
+	m.qmu.Unlock()
+
+	go func(ctx context.Context, m *Machine) {
+		defer close(l.exited)
+
+		if prev != nil {
+			<-prev.exited
+		}
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case q := <-inbox:
+				m.process(q)
+				for q, ok := m.nextInternal(); ok; q, ok = m.nextInternal() {
+					m.process(q)
+				}
+			}
+		}
+	}(ctx, m)
+}
+
+// Send queues an event for the run loop (see Run) and returns without waiting
+// for it to be processed. If the queue is full, the OverflowPolicy set with
+// WithQueue applies; by default Send blocks until there is room or ctx is done.
+// Events are processed with the context they were sent with, so values such
+// as correlation IDs are preserved; an event whose context is done by the time
+// it is processed fails with the context's error.
+//
+// Hooks, guards and actions run by the loop must not call Update or Fire, as
+// the Machine is locked while they run. They can call Send with the context
+// they were given instead: such events are queued internally, and processed
+// after the current event and before any event sent from outside the loop.
+// The internal queue has the same capacity as the queue, and at least one
+// event. When it is full, the event is discarded under OverflowDrop, and
+// ErrQueueFull is returned otherwise, as the loop cannot wait for itself.
+//
+// Example:
+//
+//	WithOnEnter("PAID", func(ctx context.Context, _ interface{}, _, _ fsm.State, _ fsm.Transition) error {
+//	    return m.Send(ctx, fsm.Event{Trigger: "ship"})
+//	})
+func (m *Machine) Send(ctx context.Context, e Event) error {
+	q := queued{ctx: ctx, e: e}
+
+	inbox := m.queue()
+
+	if ctx.Value(runKey{}) == m {
+		m.qmu.Lock()
+		defer m.qmu.Unlock()
+
+		// the internal queue holds as many events as the queue, and at least
+		// one; the loop cannot wait for itself, so OverflowBlock fails
+		if len(m.internal) >= cap(inbox) && len(m.internal) > 0 {
+			if m.overflow == OverflowDrop {
+				return nil
+			}
+			return ErrQueueFull
+		}
+		m.internal = append(m.internal, q)
+		return nil
+	}
+
+	m.qmu.Lock()
+	policy := m.overflow
+	m.qmu.Unlock()
+
+	switch policy {
+	case OverflowDrop:
+		select {
+		case inbox <- q:
+		default:
+		}
+		return nil
+	case OverflowError:
+		select {
+		case inbox <- q:
+			return nil
+		default:
+			return ErrQueueFull
+		}
+	default:
+		select {
+		case inbox <- q:
+			return nil
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
+
+// queue returns the event queue, creating it with the default size if needed.
+func (m *Machine) queue() chan queued {
+	m.qmu.Lock()
+	defer m.qmu.Unlock()
+
+	if m.inbox == nil {
+		m.inbox = make(chan queued, DefaultQueueSize)
+	}
+	return m.inbox
+}
+
+// nextInternal removes and returns the oldest event sent from within the run loop.
+func (m *Machine) nextInternal() (queued, bool) {
+	m.qmu.Lock()
+	defer m.qmu.Unlock()
+
+	if len(m.internal) == 0 {
+		return queued{}, false
+	}
+	q := m.internal[0]
+	m.internal = m.internal[1:]
+	return q, true
+}
+
+// process passes a queued event to Fire or Update and reports any error.
+func (m *Machine) process(q queued) {
+	ctx := context.WithValue(q.ctx, runKey{}, m)
+
+	var err error
+	if q.e.Trigger != "" {
+		_, err = m.Fire(ctx, q.e.Trigger, q.e.Value)
+	} else {
+		_, err = m.Update(ctx, q.e.Value)
+	}
+	if err == nil {
+		return
+	}
+
+	m.mu.RLock()
+	onError := m.onError
+	m.mu.RUnlock()
+	if onError != nil {
+		onError(err)
+	}
+}
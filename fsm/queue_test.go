@@ -0,0 +1,260 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestRunAndSend(t *testing.T) {
+	mkMachine := func(opts ...Option) (*Machine, chan string) {
+		a, b, c := NewState("A"), NewState("B"), NewState("C")
+		entered := make(chan string, 16)
+
+		m := NewMachine(append([]Option{WithTransitions(
+			a.On("next").Then(b),
+			b.On("next").Then(c),
+			c.On("next").Then(a),
+			c.On("back").Then(b),
+			a.When("is c", func(_ context.Context, v interface{}) (bool, error) {
+				return v == "c", nil
+			}).Then(c),
+		)}, opts...)...)
+		for _, name := range []string{"A", "B", "C"} {
+			name := name
+			WithOnEnter(name, func(context.Context, interface{}, State, State, Transition) error {
+				entered <- name
+				return nil
+			})(m)
+		}
+		return m, entered
+	}
+
+	receive := func(t *testing.T, ch chan string, n int) []string {
+		t.Helper()
+		var got []string
+		for i := 0; i < n; i++ {
+			select {
+			case s := <-ch:
+				got = append(got, s)
+			case <-time.After(time.Second):
+				t.Fatalf("timed out after %v", got)
+			}
+		}
+		return got
+	}
+
+	t.Run("in order", func(t *testing.T) {
+		m, entered := mkMachine()
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// events sent before Run are kept until it starts
+		for i := 0; i < 3; i++ {
+			if err := m.Send(ctx, Event{Trigger: "next"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if err := m.Send(ctx, Event{Value: "c"}); err != nil {
+			t.Fatal(err)
+		}
+		m.Run(ctx)
+		m.Run(ctx)
+
+		if got, want := receive(t, entered, 4), []string{"B", "C", "A", "C"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("send does not wait for guards", func(t *testing.T) {
+		release := make(chan struct{})
+		a, b := NewState("A"), NewState("B")
+		m := NewMachine(WithTransitions(
+			a.When("slow", func(context.Context, interface{}) (bool, error) {
+				<-release
+				return true, nil
+			}).Then(b),
+		))
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		m.Run(ctx)
+
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := 0; i < 3; i++ {
+				if err := m.Send(ctx, Event{}); err != nil {
+					t.Error(err)
+				}
+			}
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("send blocked on a guard")
+		}
+		close(release)
+	})
+
+	t.Run("events from hooks", func(t *testing.T) {
+		var m *Machine
+		m, entered := mkMachine(WithOnEnter("B", func(ctx context.Context, _ interface{}, _, _ State, _ Transition) error {
+			// queued internally, so it runs before the event sent from outside
+			return m.Send(ctx, Event{Trigger: "next"})
+		}))
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		if err := m.Send(ctx, Event{Trigger: "next"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Send(ctx, Event{Trigger: "back"}); err != nil {
+			t.Fatal(err)
+		}
+		m.Run(ctx)
+
+		if got, want := receive(t, entered, 3), []string{"B", "C", "B"}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("errors", func(t *testing.T) {
+		errs := make(chan error, 1)
+		m, _ := mkMachine(
+			WithOnEnter("B", func(context.Context, interface{}, State, State, Transition) error {
+				return errors.New("boom")
+			}),
+			WithErrorHandler(func(err error) {
+				errs <- err
+			}),
+		)
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		m.Run(ctx)
+
+		if err := m.Send(ctx, Event{Trigger: "next"}); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case err := <-errs:
+			if err.Error() != "boom" {
+				t.Fatalf("unexpected error: %v", err)
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected error")
+		}
+	})
+
+	t.Run("overflow", func(t *testing.T) {
+		ctx := context.Background()
+
+		m, _ := mkMachine(WithQueue(1, OverflowError))
+		if err := m.Send(ctx, Event{Trigger: "next"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Send(ctx, Event{Trigger: "next"}); !errors.Is(err, ErrQueueFull) {
+			t.Fatalf("expected ErrQueueFull, got %v", err)
+		}
+
+		m, _ = mkMachine(WithQueue(1, OverflowDrop))
+		for i := 0; i < 3; i++ {
+			if err := m.Send(ctx, Event{Trigger: "next"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if n := len(m.queue()); n != 1 {
+			t.Fatalf("expected 1 queued event, got %d", n)
+		}
+
+		m, _ = mkMachine(WithQueue(1, OverflowBlock))
+		if err := m.Send(ctx, Event{Trigger: "next"}); err != nil {
+			t.Fatal(err)
+		}
+		tctx, cancel := context.WithTimeout(ctx, 10*time.Millisecond)
+		defer cancel()
+		if err := m.Send(tctx, Event{Trigger: "next"}); !errors.Is(err, context.DeadlineExceeded) {
+			t.Fatalf("expected deadline error, got %v", err)
+		}
+	})
+
+	t.Run("internal overflow", func(t *testing.T) {
+		for _, tt := range []struct {
+			policy OverflowPolicy
+			want   error
+		}{
+			{OverflowBlock, ErrQueueFull},
+			{OverflowError, ErrQueueFull},
+			{OverflowDrop, nil},
+		} {
+			var m *Machine
+			sent := make(chan error, 2)
+			m, entered := mkMachine(WithQueue(1, tt.policy), WithOnEnter("B", func(ctx context.Context, _ interface{}, _, _ State, _ Transition) error {
+				for i := 0; i < 2; i++ {
+					sent <- m.Send(ctx, Event{Trigger: "next"})
+				}
+				return nil
+			}))
+			ctx, cancel := context.WithCancel(context.Background())
+			m.Run(ctx)
+			if err := m.Send(ctx, Event{Trigger: "next"}); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := <-sent; err != nil {
+				t.Fatalf("%v: expected the first event to be queued, got %v", tt.policy, err)
+			}
+			if err := <-sent; err != tt.want {
+				t.Fatalf("%v: expected %v, got %v", tt.policy, tt.want, err)
+			}
+			if got, want := receive(t, entered, 2), []string{"B", "C"}; !reflect.DeepEqual(got, want) {
+				t.Fatalf("%v: expected %v, got %v", tt.policy, want, got)
+			}
+			cancel()
+		}
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		m, entered := mkMachine()
+		ctx, cancel := context.WithCancel(context.Background())
+		m.Run(ctx)
+		cancel()
+
+		// once the loop has stopped, Run starts a new one
+		m.qmu.Lock()
+		exited := m.loop.exited
+		m.qmu.Unlock()
+		<-exited
+
+		ctx, cancel = context.WithCancel(context.Background())
+		defer cancel()
+		m.Run(ctx)
+		if err := m.Send(ctx, Event{Trigger: "next"}); err != nil {
+			t.Fatal(err)
+		}
+		if got := receive(t, entered, 1); got[0] != "B" {
+			t.Fatalf("expected B, got %v", got)
+		}
+	})
+
+	t.Run("run after cancel", func(t *testing.T) {
+		for i := 0; i < 50; i++ {
+			m, entered := mkMachine()
+			ctx, cancel := context.WithCancel(context.Background())
+			m.Run(ctx)
+			cancel()
+
+			// the new loop starts even if the previous one has not returned yet
+			ctx, cancel = context.WithCancel(context.Background())
+			m.Run(ctx)
+			if err := m.Send(ctx, Event{Trigger: "next"}); err != nil {
+				t.Fatal(err)
+			}
+			if got := receive(t, entered, 1); got[0] != "B" {
+				t.Fatalf("expected B, got %v", got)
+			}
+			cancel()
+		}
+	})
+}
@@ -0,0 +1,225 @@
+package fsm
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// SnapshotVersion is the version of the Snapshot format produced by Machine.Snapshot.
+// Version 2 added ShallowHistory and DeepHistory; version 1 snapshots can still be restored.
+const SnapshotVersion = 2
+
+// Snapshot is a serializable record of where a Machine is.
+// It holds state names rather than states, so it can be restored into a Machine
+// built from the same definition in another process.
+type Snapshot struct {
+	Version   int            `json:"version"`              // Format version, see SnapshotVersion
+	Current   string         `json:"current"`              // Name of the current state
+	Start     string         `json:"start"`                // Name of the start state
+	EndStates []string       `json:"end_states,omitempty"` // Names of the end states, sorted
+	History   []HistoryEntry `json:"history,omitempty"`    // Recorded history, if enabled
+
+	ShallowHistory map[string]string `json:"shallow_history,omitempty"` // Child last active in each exited parent, by parent name
+	DeepHistory    map[string]string `json:"deep_history,omitempty"`    // Innermost state last active in each exited parent, by parent name
+}
+
+// Snapshot returns a Snapshot of the Machine's current state, start state,
+// end states, the configuration remembered for history pseudo-states (see
+// HistoryOf) and, if enabled with WithHistory, its recorded history.
+//
+// Example:
+//
+//	snap := m.Snapshot()
+//	if err := fsm.JSONCodec{}.Encode(w, snap); err != nil {
+//	    // handle error
+//	}
+func (m *Machine) Snapshot() Snapshot {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	s := Snapshot{Version: SnapshotVersion}
+
+	if start, _ := m.start.Load().(State); start != nil {
+		s.Start = start.Name()
+	}
+	if curr := m.current(); curr != nil {
+		s.Current = curr.Name()
+	}
+
+	for _, st := range m.endStates {
+		s.EndStates = append(s.EndStates, st.Name())
+	}
+	sort.Strings(s.EndStates)
+
+	if m.history != nil {
+		s.History = m.history.entries()
+	}
+
+	s.ShallowHistory = m.rememberedNames(m.shallow)
+	s.DeepHistory = m.rememberedNames(m.deep)
+
+	return s
+}
+
+// Restore moves the Machine to the state recorded in the Snapshot.
+// The snapshot is validated against the Machine's transitions first: it returns
+// an error, and leaves the Machine untouched, if the version is not supported
+// or if any of the named states is unknown to the Machine.
+// Hooks and actions are not run. The configuration remembered for history
+// pseudo-states is always restored; recorded transitions are only restored if
+// the Machine was created with WithHistory. If end states are terminal (see
+// WithTerminalEndStates), a Machine restored to an end state is completed.
+//
+// Example:
+//
+//	snap, err := fsm.JSONCodec{}.Decode(r)
+//	if err != nil {
+//	    // handle error
+//	}
+//	if err := m.Restore(snap); err != nil {
+//	    // handle error
+//	}
+func (m *Machine) Restore(s Snapshot) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if s.Version < 1 || s.Version > SnapshotVersion {
+		return fmt.Errorf("%w: %d", ErrUnsupportedSnapshot, s.Version)
+	}
+
+	start := m.lookup(s.Start)
+	if start == nil {
+		return fmt.Errorf("invalid start state: %w", &UnknownStateError{Name: s.Start})
+	}
+	curr := m.lookup(s.Current)
+	if curr == nil {
+		return fmt.Errorf("invalid current state: %w", &UnknownStateError{Name: s.Current})
+	}
+	endStates := make(map[uint64]State, len(s.EndStates))
+	for _, name := range s.EndStates {
+		st := m.lookup(name)
+		if st == nil {
+			return fmt.Errorf("invalid end state: %w", &UnknownStateError{Name: name})
+		}
+		endStates[st.Id()] = st
+	}
+
+	shallow, err := m.remembered(s.ShallowHistory)
+	if err != nil {
+		return err
+	}
+	deep, err := m.remembered(s.DeepHistory)
+	if err != nil {
+		return err
+	}
+	// a composite current state, as recorded by older snapshots, is entered
+	// down to its initial sub-state
+	curr = resolve(m.initial, shallow, deep, curr)
+
+	m.start.Store(start)
+	m.curr.Store(curr)
+	m.endStates = endStates
+	m.shallow, m.deep = shallow, deep
+	m.setCompleted(m.terminates(curr))
+	m.rearm()
+
+	if m.history != nil {
+		m.history = &historyRing{buf: make([]HistoryEntry, len(m.history.buf))}
+		for _, e := range s.History {
+			m.history.add(e)
+		}
+	}
+
+	return nil
+}
+
+// rememberedNames converts a map of remembered states, keyed by the id of
+// their parent, to a map of state names keyed by the name of the parent.
+// It returns nil if nothing is remembered. The caller must hold m.mu.
+func (m *Machine) rememberedNames(remembered map[uint64]State) map[string]string {
+	if len(remembered) == 0 {
+		return nil
+	}
+
+	out := make(map[string]string, len(remembered))
+	for _, parent := range m.states() {
+		if s, ok := remembered[parent.Id()]; ok {
+			out[parent.Name()] = s.Name()
+		}
+	}
+	return out
+}
+
+// remembered converts a map of state names keyed by the name of their parent,
+// as stored in a Snapshot, back to a map of remembered states. It returns an
+// error if a state is unknown or is not a descendant of the named parent.
+// The caller must hold m.mu.
+func (m *Machine) remembered(names map[string]string) (map[uint64]State, error) {
+	if len(names) == 0 {
+		return nil, nil
+	}
+
+	out := make(map[uint64]State, len(names))
+	for parentName, name := range names {
+		parent := m.lookup(parentName)
+		if parent == nil {
+			return nil, fmt.Errorf("invalid history state: %w", &UnknownStateError{Name: parentName})
+		}
+		s := m.lookup(name)
+		if s == nil {
+			return nil, fmt.Errorf("invalid history of '%s': %w", parentName, &UnknownStateError{Name: name})
+		}
+		if !descends(s, parent) {
+			return nil, fmt.Errorf("invalid history of '%s': '%s'", parentName, name)
+		}
+		out[parent.Id()] = s
+	}
+	return out, nil
+}
+
+// SnapshotCodec encodes and decodes snapshots for persistence.
+type SnapshotCodec interface {
+	// Encode writes the snapshot to w.
+	Encode(w io.Writer, s Snapshot) error
+	// Decode reads a snapshot from r.
+	Decode(r io.Reader) (Snapshot, error)
+}
+
+// JSONCodec is a SnapshotCodec that uses encoding/json.
+type JSONCodec struct{}
+
+// Ensure JSONCodec implements the SnapshotCodec interface
+var _ SnapshotCodec = JSONCodec{}
+
+// Encode writes the snapshot to w as JSON.
+func (JSONCodec) Encode(w io.Writer, s Snapshot) error {
+	return json.NewEncoder(w).Encode(s)
+}
+
+// Decode reads a JSON snapshot from r.
+func (JSONCodec) Decode(r io.Reader) (Snapshot, error) {
+	var s Snapshot
+	err := json.NewDecoder(r).Decode(&s)
+	return s, err
+}
+
+// GobCodec is a SnapshotCodec that uses encoding/gob.
+type GobCodec struct{}
+
+// Ensure GobCodec implements the SnapshotCodec interface
+var _ SnapshotCodec = GobCodec{}
+
+// Encode writes the snapshot to w using gob.
+func (GobCodec) Encode(w io.Writer, s Snapshot) error {
+	return gob.NewEncoder(w).Encode(s)
+}
+
+// Decode reads a gob encoded snapshot from r.
+func (GobCodec) Decode(r io.Reader) (Snapshot, error) {
+	var s Snapshot
+	err := gob.NewDecoder(r).Decode(&s)
+	return s, err
+}
@@ -0,0 +1,116 @@
+package fsm
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"testing"
+)
+
+func TestSnapshot(t *testing.T) {
+	s1 := NewState("STATE1")
+	s2 := NewState("STATE2")
+	s3 := NewState("STATE3")
+	transitions := []Transition{
+		s1.When("v == 'a'", func(_ context.Context, v interface{}) (bool, error) {
+			return v == byte('a'), nil
+		}).Then(s2),
+		s2.When("v == 'b'", func(_ context.Context, v interface{}) (bool, error) {
+			return v == byte('b'), nil
+		}).Then(s3),
+	}
+
+	mkMachine := func(t *testing.T) *Machine {
+		t.Helper()
+
+		m := NewMachine(WithTransitions(transitions...), WithHistory(5))
+		if err := m.SetEndStates("STATE3"); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+
+	t.Run("round trip", func(t *testing.T) {
+		codecs := map[string]SnapshotCodec{
+			"json": JSONCodec{},
+			"gob":  GobCodec{},
+		}
+		for name, codec := range codecs {
+			codec := codec
+			t.Run(name, func(t *testing.T) {
+				m := mkMachine(t)
+				if _, err := m.Update(context.Background(), byte('a')); err != nil {
+					t.Fatal(err)
+				}
+
+				snap := m.Snapshot()
+				if snap.Version != SnapshotVersion || snap.Current != "STATE2" || snap.Start != "STATE1" {
+					t.Fatalf("unexpected snapshot: %+v", snap)
+				}
+
+				var buf bytes.Buffer
+				if err := codec.Encode(&buf, snap); err != nil {
+					t.Fatal(err)
+				}
+				decoded, err := codec.Decode(&buf)
+				if err != nil {
+					t.Fatal(err)
+				}
+
+				restored := NewMachine(WithTransitions(transitions...), WithHistory(5))
+				if err := restored.Restore(decoded); err != nil {
+					t.Fatal(err)
+				}
+				if restored.Current().Id() != s2.Id() {
+					t.Fatal("expected STATE2")
+				}
+				if !reflect.DeepEqual(restored.Snapshot().EndStates, []string{"STATE3"}) {
+					t.Fatal("expected end states to be restored")
+				}
+				if h := restored.History(); len(h) != 1 || h[0].To != "STATE2" {
+					t.Fatalf("unexpected history: %+v", h)
+				}
+
+				if _, err := restored.Update(context.Background(), byte('b')); err != nil {
+					t.Fatal(err)
+				}
+				if !restored.IsEndState() {
+					t.Fatal("expected end state")
+				}
+				if err := restored.Reset(); err != nil {
+					t.Fatal(err)
+				}
+				if restored.Current().Id() != s1.Id() {
+					t.Fatal("expected start state to be restored")
+				}
+			})
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		tests := []struct {
+			name string
+			snap Snapshot
+		}{
+			{name: "version", snap: Snapshot{Version: SnapshotVersion + 1, Current: "STATE1", Start: "STATE1"}},
+			{name: "current", snap: Snapshot{Version: SnapshotVersion, Current: "STATE4", Start: "STATE1"}},
+			{name: "start", snap: Snapshot{Version: SnapshotVersion, Current: "STATE1", Start: "STATE4"}},
+			{name: "end", snap: Snapshot{Version: SnapshotVersion, Current: "STATE1", Start: "STATE1", EndStates: []string{"STATE4"}}},
+		}
+		for _, tt := range tests {
+			tt := tt
+			t.Run(tt.name, func(t *testing.T) {
+				m := mkMachine(t)
+				if _, err := m.Update(context.Background(), byte('a')); err != nil {
+					t.Fatal(err)
+				}
+				if err := m.Restore(tt.snap); err == nil {
+					t.Fatal("expected error")
+				}
+				if m.Current().Id() != s2.Id() {
+					t.Fatal("expected machine to be untouched")
+				}
+			})
+		}
+	})
+}
@@ -0,0 +1,180 @@
+package fsm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Spec is a declarative description of a Machine.
+// It can be decoded from JSON with LoadSpec, or from any other format (such as
+// YAML) by decoding into a Spec and calling Spec.Machine.
+//
+// Example JSON document:
+//
+//	{
+//	  "states": ["PENDING", "PAID", "CANCELLED"],
+//	  "start": "PENDING",
+//	  "end": ["PAID", "CANCELLED"],
+//	  "transitions": [
+//	    {"from": "PENDING", "to": "PAID", "guard": "isPaid", "description": "payment received"},
+//	    {"from": "PENDING", "to": "CANCELLED", "event": "cancel", "action": "refund"}
+//	  ]
+//	}
+type Spec struct {
+	States      []string         `json:"states" yaml:"states"`           // Names of all states
+	Start       string           `json:"start,omitempty" yaml:"start"`   // Name of the start state
+	End         []string         `json:"end,omitempty" yaml:"end"`       // Names of the end states
+	Transitions []TransitionSpec `json:"transitions" yaml:"transitions"` // Transitions between states
+}
+
+// TransitionSpec is a declarative description of a Transition.
+// Guard and Action are names resolved against a Registry. A transition must
+// have a guard unless it is keyed by an event, in which case the guard is
+// optional.
+type TransitionSpec struct {
+	From        string `json:"from" yaml:"from"`                         // Source state
+	To          string `json:"to" yaml:"to"`                             // Destination state
+	Event       string `json:"event,omitempty" yaml:"event"`             // Event keyed by, if any
+	Guard       string `json:"guard,omitempty" yaml:"guard"`             // TriggerFunc in the Registry
+	Action      string `json:"action,omitempty" yaml:"action"`           // ActionFunc, if any
+	Description string `json:"description,omitempty" yaml:"description"` // Defaults to Guard
+	Priority    int    `json:"priority,omitempty" yaml:"priority"`       // See Transition.Prioritize
+}
+
+// Registry holds the functions a Spec refers to by name.
+//
+// Example:
+//
+//	reg := fsm.Registry{
+//		Guards: map[string]fsm.TriggerFunc{
+//			"isPaid": isPaid,
+//		},
+//		Actions: map[string]fsm.ActionFunc{
+//			"refund": refund,
+//		},
+//	}
+type Registry struct {
+	Guards  map[string]TriggerFunc // Guards by name
+	Actions map[string]ActionFunc  // Actions by name
+}
+
+// LoadSpec reads a JSON Spec from r and builds a Machine from it, resolving
+// guard and action names against reg. Unknown fields in the document are rejected.
+// See Spec.Machine for the checks performed on the definition.
+//
+// Example:
+//
+//	f, _ := os.Open("order.json")
+//	m, err := fsm.LoadSpec(f, reg)
+//	if err != nil {
+//	    // handle error
+//	}
+func LoadSpec(r io.Reader, reg Registry) (*Machine, error) {
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+
+	var s Spec
+	if err := dec.Decode(&s); err != nil {
+		return nil, fmt.Errorf("invalid spec: %w", err)
+	}
+
+	return s.Machine(reg)
+}
+
+// Machine builds a Machine from the Spec, resolving guard and action names
+// against reg. See Spec.Definition for the checks performed.
+func (s Spec) Machine(reg Registry) (*Machine, error) {
+	def, err := s.Definition(reg)
+	if err != nil {
+		return nil, err
+	}
+
+	return def.New(), nil
+}
+
+// Definition builds a Definition from the Spec with a Builder, resolving guard
+// and action names against reg. It returns an error naming the offending entry
+// if a state is declared twice, a transition refers to an undeclared state or
+// an unknown guard or action, a transition has neither a guard nor an event, a
+// declared state is not used by any transition, or if the start or end states
+// are invalid. The resulting Machine must also pass Machine.Validate. If no
+// start state is given, the source of the first transition is used.
+//
+// Example:
+//
+//	def, err := spec.Definition(reg)
+//	if err != nil {
+//	    // handle error
+//	}
+//	for _, order := range orders {
+//	    machines[order.ID] = def.New()
+//	}
+func (s Spec) Definition(reg Registry) (*Definition, error) {
+	b := NewBuilder()
+
+	declared := make(map[string]bool, len(s.States))
+	for _, name := range s.States {
+		if declared[name] {
+			return nil, fmt.Errorf("duplicate state: '%s'", name)
+		}
+		declared[name] = true
+		b.State(name)
+	}
+
+	for i, ts := range s.Transitions {
+		if !declared[ts.From] {
+			return nil, fmt.Errorf("transition %d: from: %w", i, &UnknownStateError{Name: ts.From})
+		}
+		if !declared[ts.To] {
+			return nil, fmt.Errorf("transition %d: to: %w", i, &UnknownStateError{Name: ts.To})
+		}
+
+		var t *BuilderTransition
+		switch {
+		case ts.Event == "" && ts.Guard == "":
+			return nil, fmt.Errorf("transition %d: missing guard", i)
+		case ts.Guard != "":
+			guard, ok := reg.Guards[ts.Guard]
+			if !ok || guard == nil {
+				return nil, fmt.Errorf("transition %d: unknown guard: '%s'", i, ts.Guard)
+			}
+			desc := ts.Description
+			if desc == "" {
+				desc = ts.Guard
+			}
+			t = b.When(ts.From, desc, guard)
+			if ts.Event != "" {
+				t = t.On(Trigger(ts.Event))
+			}
+		case ts.Description != "":
+			t = b.When(ts.From, ts.Description, nil).On(Trigger(ts.Event))
+		default:
+			t = b.On(ts.From, Trigger(ts.Event))
+		}
+
+		if ts.Action != "" {
+			action, ok := reg.Actions[ts.Action]
+			if !ok || action == nil {
+				return nil, fmt.Errorf("transition %d: unknown action: '%s'", i, ts.Action)
+			}
+			t = t.Do(action)
+		}
+
+		if ts.Priority != 0 {
+			t = t.Prioritize(ts.Priority)
+		}
+
+		t.Then(ts.To)
+	}
+
+	if s.Start != "" {
+		if !declared[s.Start] {
+			return nil, fmt.Errorf("start: %w", &UnknownStateError{Name: s.Start})
+		}
+		b.Start(s.Start)
+	}
+	b.End(s.End...)
+
+	return b.Build()
+}
@@ -0,0 +1,156 @@
+package fsm
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestLoadSpec(t *testing.T) {
+	var refunded bool
+	reg := Registry{
+		Guards: map[string]TriggerFunc{
+			"isPaid":   is("paid"),
+			"isCancel": is("cancel"),
+			"isShip":   is("ship"),
+		},
+		Actions: map[string]ActionFunc{
+			"refund": func(context.Context, interface{}) error {
+				refunded = true
+				return nil
+			},
+		},
+	}
+
+	const doc = `{
+		"states": ["PENDING", "PAID", "SHIPPED", "CANCELLED"],
+		"start": "PENDING",
+		"end": ["SHIPPED", "CANCELLED"],
+		"transitions": [
+			{"from": "PENDING", "to": "PAID", "guard": "isPaid", "description": "payment received"},
+			{"from": "PAID", "to": "SHIPPED", "guard": "isShip"},
+			{"from": "PAID", "to": "CANCELLED", "guard": "isCancel", "action": "refund"},
+			{"from": "PENDING", "to": "CANCELLED", "guard": "isCancel"},
+			{"from": "PAID", "to": "PENDING", "event": "chargeback"}
+		]
+	}`
+
+	t.Run("valid", func(t *testing.T) {
+		m, err := LoadSpec(strings.NewReader(doc), reg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx := context.Background()
+		for _, v := range []string{"paid", "cancel"} {
+			if changed, err := m.Update(ctx, v); !changed || err != nil {
+				t.Fatalf("update %s: unexpected result: %v, %v", v, changed, err)
+			}
+		}
+		if m.Current().Name() != "CANCELLED" || !m.IsEndState() {
+			t.Fatalf("expected end state CANCELLED, got %s", m.Current().Name())
+		}
+		if !refunded {
+			t.Fatal("expected refund action")
+		}
+	})
+
+	t.Run("events", func(t *testing.T) {
+		m, err := LoadSpec(strings.NewReader(doc), reg)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		ctx := context.Background()
+		if _, err := m.Update(ctx, "paid"); err != nil {
+			t.Fatal(err)
+		}
+		if changed, err := m.Fire(ctx, "chargeback", nil); !changed || err != nil {
+			t.Fatalf("unexpected result: %v, %v", changed, err)
+		}
+		if m.Current().Name() != "PENDING" {
+			t.Fatalf("expected PENDING, got %s", m.Current().Name())
+		}
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		tests := []struct {
+			name    string
+			doc     string
+			wantErr string
+		}{
+			{
+				name:    "malformed",
+				doc:     `{"states": [}`,
+				wantErr: "invalid spec",
+			},
+			{
+				name:    "unknown field",
+				doc:     `{"states": ["A", "B"], "nope": 1}`,
+				wantErr: "invalid spec",
+			},
+			{
+				name:    "duplicate state",
+				doc:     `{"states": ["A", "A"], "transitions": []}`,
+				wantErr: "duplicate state: 'A'",
+			},
+			{
+				name:    "unknown from state",
+				doc:     `{"states": ["A", "B"], "transitions": [{"from": "C", "to": "B", "guard": "isPaid"}]}`,
+				wantErr: "transition 0: from: unknown state: 'C'",
+			},
+			{
+				name:    "unknown to state",
+				doc:     `{"states": ["A", "B"], "transitions": [{"from": "A", "to": "C", "guard": "isPaid"}]}`,
+				wantErr: "transition 0: to: unknown state: 'C'",
+			},
+			{
+				name:    "unknown guard",
+				doc:     `{"states": ["A", "B"], "transitions": [{"from": "A", "to": "B", "guard": "isLate"}]}`,
+				wantErr: "transition 0: unknown guard: 'isLate'",
+			},
+			{
+				name:    "missing guard",
+				doc:     `{"states": ["A", "B"], "transitions": [{"from": "A", "to": "B"}]}`,
+				wantErr: "transition 0: missing guard",
+			},
+			{
+				name:    "unknown action",
+				doc:     `{"states": ["A", "B"], "transitions": [{"from": "A", "to": "B", "guard": "isPaid", "action": "charge"}]}`,
+				wantErr: "transition 0: unknown action: 'charge'",
+			},
+			{
+				name:    "unused state",
+				doc:     `{"states": ["A", "B", "C"], "transitions": [{"from": "A", "to": "B", "guard": "isPaid"}]}`,
+				wantErr: "state 'C' is not used by any transition",
+			},
+			{
+				name:    "unknown start state",
+				doc:     `{"states": ["A", "B"], "start": "C", "transitions": [{"from": "A", "to": "B", "guard": "isPaid"}]}`,
+				wantErr: "start: unknown state: 'C'",
+			},
+			{
+				name:    "unknown end state",
+				doc:     `{"states": ["A", "B"], "end": ["C"], "transitions": [{"from": "A", "to": "B", "guard": "isPaid"}]}`,
+				wantErr: "unknown state: 'C'",
+			},
+			{
+				name:    "no transitions",
+				doc:     `{"states": []}`,
+				wantErr: "no start state set",
+			},
+		}
+		for _, tt := range tests {
+			tt := tt
+			t.Run(tt.name, func(t *testing.T) {
+				_, err := LoadSpec(strings.NewReader(tt.doc), reg)
+				if err == nil {
+					t.Fatal("expected error")
+				}
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("expected error containing %q, got %q", tt.wantErr, err.Error())
+				}
+			})
+		}
+	})
+}
@@ -7,6 +7,7 @@ package fsm
 import (
 	"context"
 	"sync/atomic"
+	"time"
 )
 
 //go:generate go run github.com/schigh/slice/cmd/slicify Transition all
@@ -35,7 +36,9 @@ func mkID() uint64 {
 }
 
 // Trigger is a type representing a trigger event in the state machine.
-type Trigger uint
+// Transitions keyed by a Trigger (see State.On and Transition.On) are only
+// considered by Machine.Fire, never by Machine.Update.
+type Trigger string
 
 // TriggerFunc is a function type that evaluates whether a transition should occur.
 // It takes a context for cancellation and a value to evaluate against.
@@ -53,6 +56,18 @@ type Trigger uint
 //	})
 type TriggerFunc func(context.Context, interface{}) (bool, error)
 
+// ActionFunc is a function type for side-effects that belong to a transition.
+// It takes a context for cancellation and the value that caused the transition.
+// If it returns an error, the transition is not committed and the Machine stays
+// in its current state.
+//
+// Example:
+//
+//	t := s1.When("paid", isPaid).Do(func(ctx context.Context, v interface{}) error {
+//	    return ship(ctx, v.(Order))
+//	}).Then(s2)
+type ActionFunc func(context.Context, interface{}) error
+
 // Identifier is an interface for objects with unique IDs.
 // All states and transitions implement this interface.
 type Identifier interface {
@@ -66,10 +81,17 @@ type State interface {
 	Identifier
 	// Name returns the name of the state.
 	Name() string
+	// Parent returns the super-state of the state, or nil for a top-level state.
+	Parent() State
 	// When creates a new transition from this state with the specified condition.
 	// The description parameter provides a human-readable description of the condition.
 	// The TriggerFunc determines when the transition should occur.
 	When(string, TriggerFunc) Transition
+	// On creates a new transition from this state that fires on the specified event.
+	On(Trigger) Transition
+	// After creates a new transition from this state that fires once the state
+	// has been active for the specified duration.
+	After(time.Duration) Transition
 }
 
 // Transition represents a transition between states in the finite state machine.
@@ -85,9 +107,24 @@ type Transition interface {
 	To() State
 	// Then sets the destination state of the transition and returns the transition.
 	Then(State) Transition
+	// Do sets the action run when the transition fires and returns the transition.
+	Do(ActionFunc) Transition
+	// On keys the transition by the specified event and returns the transition.
+	On(Trigger) Transition
+	// Trigger returns the event the transition is keyed by, or an empty Trigger.
+	Trigger() Trigger
+	// Timeout returns the duration after which the transition fires, or zero
+	// if it is not a timed transition.
+	Timeout() time.Duration
+	// Prioritize sets the priority of the transition and returns the transition.
+	Prioritize(int) Transition
+	// Priority returns the priority of the transition; the default is zero.
+	Priority() int
 	// Go evaluates whether the transition should occur based on the provided value.
 	// Returns true if the transition should occur, false otherwise.
 	Go(context.Context, interface{}) (bool, error)
+	// Exec runs the action of the transition, if any, with the provided value.
+	Exec(context.Context, interface{}) error
 }
 
 // machineState is the concrete implementation of the State interface.
@@ -95,12 +132,40 @@ type Transition interface {
 type machineState struct {
 	name string  // The name of the state
 	id   uint64  // The unique identifier for the state
+
+	parent  State // The super-state, if any
+	initial bool  // Whether the state is entered by default when its parent is entered
 }
 
 // StateOption is a function type used to configure a machineState.
 // It follows the functional options pattern for configuring states.
 type StateOption func(machineState) machineState
 
+// WithParent creates a StateOption that makes the state a sub-state of parent.
+// Transitions from parent apply to all of its descendants, and entering or
+// leaving the state also enters or leaves its ancestors as needed.
+//
+// Example:
+//
+//	processing := fsm.NewState("PROCESSING")
+//	validating := fsm.NewState("VALIDATING", fsm.WithParent(processing), fsm.AsInitial())
+//	charging := fsm.NewState("CHARGING", fsm.WithParent(processing))
+func WithParent(parent State) StateOption {
+	return func(s machineState) machineState {
+		s.parent = parent
+		return s
+	}
+}
+
+// AsInitial creates a StateOption that makes the state the initial sub-state of
+// its parent: a transition that targets the parent enters this state instead.
+func AsInitial() StateOption {
+	return func(s machineState) machineState {
+		s.initial = true
+		return s
+	}
+}
+
 // NewState creates a new state with the specified name and options.
 // Each state has a unique ID generated automatically.
 //
@@ -122,6 +187,16 @@ func (s machineState) Name() string {
 	return s.name
 }
 
+// Parent returns the super-state of the state, or nil for a top-level state.
+func (s machineState) Parent() State {
+	return s.parent
+}
+
+// isInitial reports whether the state is the initial sub-state of its parent.
+func (s machineState) isInitial() bool {
+	return s.initial
+}
+
 // When creates a new transition from this state with the specified condition.
 // The description parameter provides a human-readable description of the condition.
 // The TriggerFunc determines when the transition should occur.
@@ -138,6 +213,36 @@ func (s machineState) When(desc string, f TriggerFunc) Transition {
 	return &edge{id: mkID(), from: s, f: f, desc: desc}
 }
 
+// On creates a new transition from this state that fires when the specified
+// event is passed to Machine.Fire. The transition has no guard; one can be
+// added by creating the transition with When and keying it with Transition.On.
+// The event name is used as the description of the transition.
+//
+// Example:
+//
+//	t := s1.On("cancel").Then(cancelled)
+func (s machineState) On(trigger Trigger) Transition {
+	return &edge{id: mkID(), from: s, desc: string(trigger), trigger: trigger}
+}
+
+// After creates a new transition from this state that fires once the state has
+// been active for d, unless it is left earlier. The timer is started when the
+// state is entered and stopped when it is left; see WithClock to control time.
+// Timed transitions are never considered by Update or Fire. The duration is
+// used as the description of the transition.
+// Panics if d is not positive.
+//
+// Example:
+//
+//	t := awaitingPayment.After(15 * time.Minute).Then(expired)
+func (s machineState) After(d time.Duration) Transition {
+	if d <= 0 {
+		panic("timeout must be positive")
+	}
+
+	return &edge{id: mkID(), from: s, desc: "after " + d.String(), timeout: d}
+}
+
 // Id returns the unique identifier for this state.
 func (s machineState) Id() uint64 {
 	return s.id
@@ -150,7 +255,12 @@ type edge struct {
 	from State       // Source state of the transition
 	to   State       // Destination state of the transition
 	f    TriggerFunc // Function that determines when the transition should occur
+	act  ActionFunc  // Side-effect run when the transition fires
 	id   uint64      // Unique identifier for the transition
+
+	trigger  Trigger       // Event the transition is keyed by, if any
+	timeout  time.Duration // Time after which the transition fires, if any
+	priority int           // Priority under the HighestPriority policy
 }
 
 // Id returns the unique identifier for this transition.
@@ -187,6 +297,71 @@ func (e *edge) Then(s State) Transition {
 // Go evaluates whether the transition should occur based on the provided value.
 // It delegates to the TriggerFunc associated with this transition.
 // Returns true if the transition should occur, false otherwise.
+// A transition without a TriggerFunc always occurs.
 func (e *edge) Go(ctx context.Context, v interface{}) (bool, error) {
+	if e.f == nil {
+		return true, nil
+	}
 	return e.f(ctx, v)
 }
+
+// Do sets the action run when the transition fires and returns the transition.
+// The action runs after the guard has passed and before the state changes;
+// if it returns an error the state is left unchanged.
+// This method is part of the fluent API for creating transitions.
+//
+// Example:
+//
+//	t := s1.When("condition", conditionFunc).Do(actionFunc).Then(s2)
+func (e *edge) Do(f ActionFunc) Transition {
+	e.act = f
+	return e
+}
+
+// Exec runs the action associated with this transition.
+// It returns nil if the transition has no action.
+func (e *edge) Exec(ctx context.Context, v interface{}) error {
+	if e.act == nil {
+		return nil
+	}
+	return e.act(ctx, v)
+}
+
+// On keys the transition by the specified event and returns the transition.
+// A keyed transition is only considered by Machine.Fire, and its TriggerFunc,
+// if any, acts as a guard evaluated with the event payload.
+//
+// Example:
+//
+//	t := s1.When("amount > 0", hasAmount).On("pay").Then(s2)
+func (e *edge) On(trigger Trigger) Transition {
+	e.trigger = trigger
+	return e
+}
+
+// Trigger returns the event the transition is keyed by, or an empty Trigger.
+func (e *edge) Trigger() Trigger {
+	return e.trigger
+}
+
+// Timeout returns the duration after which the transition fires, or zero.
+func (e *edge) Timeout() time.Duration {
+	return e.timeout
+}
+
+// Prioritize sets the priority of the transition and returns the transition.
+// Under the HighestPriority policy (see WithConflictPolicy), transitions with a
+// higher priority are evaluated first. Priorities can be negative.
+//
+// Example:
+//
+//	t := s1.When("vip", isVIP).Prioritize(10).Then(fastLane)
+func (e *edge) Prioritize(p int) Transition {
+	e.priority = p
+	return e
+}
+
+// Priority returns the priority of the transition.
+func (e *edge) Priority() int {
+	return e.priority
+}
@@ -0,0 +1,111 @@
+package fsm
+
+// WithTerminalEndStates creates an Option that makes end states terminal (see
+// SetEndStates). When a transition enters an end state, the Machine is marked
+// completed: the channel returned by Done is closed, the hooks registered with
+// WithOnComplete are run, the timers of the active states are stopped, and
+// Update, Fire and their dry-run counterparts return ErrTerminalState until
+// the Machine is reset.
+//
+// Without this option, end states have no effect on Update and Fire.
+//
+// Example:
+//
+//	m := fsm.NewMachine(fsm.WithTransitions(t1, t2), fsm.WithTerminalEndStates())
+//	_ = m.SetEndStates("DONE")
+func WithTerminalEndStates() Option {
+	return func(m *Machine) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		m.terminal = true
+	}
+}
+
+// WithOnComplete creates an Option that registers a hook to be run when the
+// Machine completes, after the enter hooks of the end state. It is only run if
+// the Machine was created with WithTerminalEndStates, and not if an enter hook
+// fails. An error returned by the hook is returned as (true, err), since the
+// state has already changed.
+//
+// Example:
+//
+//	fsm.WithOnComplete(func(ctx context.Context, _ interface{}, _, to fsm.State, _ fsm.Transition) error {
+//	    log.Println("finished in", to.Name())
+//	    return nil
+//	})
+func WithOnComplete(f HookFunc) Option {
+	return func(m *Machine) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		m.onComplete = append(m.onComplete, f)
+	}
+}
+
+// Done returns a channel that is closed when the Machine completes (see
+// WithTerminalEndStates). Reset and SetStart make the Machine runnable again;
+// Done must then be called again to wait for the next completion.
+//
+// Example:
+//
+//	select {
+//	case <-m.Done():
+//	    fmt.Println("finished in", m.Current().Name())
+//	case <-ctx.Done():
+//	}
+func (m *Machine) Done() <-chan struct{} {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.done == nil {
+		m.done = make(chan struct{})
+		if m.completed {
+			close(m.done)
+		}
+	}
+	return m.done
+}
+
+// Completed reports whether the Machine has reached an end state while
+// WithTerminalEndStates is in effect.
+//
+// Example:
+//
+//	if m.Completed() {
+//	    return
+//	}
+func (m *Machine) Completed() bool {
+	m.mu.RLock()
+	defer m.mu.RUnlock()
+
+	return m.completed
+}
+
+// terminates reports whether entering s completes the Machine.
+// The caller must hold m.mu.
+func (m *Machine) terminates(s State) bool {
+	if !m.terminal || s == nil {
+		return false
+	}
+	_, ok := m.endStates[s.Id()]
+	return ok
+}
+
+// setCompleted marks the Machine as completed or runnable, closing the
+// channel returned by Done on completion and replacing it when the Machine
+// becomes runnable again. The caller must hold m.mu.
+func (m *Machine) setCompleted(completed bool) {
+	if completed == m.completed {
+		return
+	}
+
+	m.completed = completed
+	if completed {
+		if m.done != nil {
+			close(m.done)
+		}
+		return
+	}
+	m.done = nil
+}
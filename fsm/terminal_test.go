@@ -0,0 +1,152 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestTerminalEndStates(t *testing.T) {
+	mkMachine := func(opts ...Option) *Machine {
+		a, b, c := NewState("A"), NewState("B"), NewState("C")
+		m := NewMachine(append([]Option{WithTransitions(
+			a.On("next").Then(b),
+			b.On("next").Then(c),
+			c.On("next").Then(a),
+		)}, opts...)...)
+		if err := m.SetEndStates("C"); err != nil {
+			t.Fatal(err)
+		}
+		return m
+	}
+	fire := func(m *Machine, n int) {
+		t.Helper()
+		for i := 0; i < n; i++ {
+			if _, err := m.Fire(context.Background(), "next", nil); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	t.Run("disabled", func(t *testing.T) {
+		m := mkMachine()
+		fire(m, 3)
+		if m.Completed() || m.Current().Name() != "A" {
+			t.Fatalf("expected end states to have no effect, got %s", m.Current().Name())
+		}
+	})
+
+	t.Run("complete", func(t *testing.T) {
+		var completions []string
+		m := mkMachine(WithTerminalEndStates(), WithOnComplete(func(_ context.Context, _ interface{}, from, to State, _ Transition) error {
+			completions = append(completions, from.Name()+">"+to.Name())
+			return nil
+		}))
+		done := m.Done()
+
+		fire(m, 1)
+		select {
+		case <-done:
+			t.Fatal("expected machine to be running")
+		default:
+		}
+
+		fire(m, 1)
+		if !m.Completed() || len(completions) != 1 || completions[0] != "B>C" {
+			t.Fatalf("expected completion, got %v", completions)
+		}
+		select {
+		case <-done:
+		default:
+			t.Fatal("expected Done to be closed")
+		}
+
+		if _, err := m.Fire(context.Background(), "next", nil); !errors.Is(err, ErrTerminalState) {
+			t.Fatalf("expected ErrTerminalState, got %v", err)
+		}
+		if _, err := m.Update(context.Background(), nil); !errors.Is(err, ErrTerminalState) {
+			t.Fatalf("expected ErrTerminalState, got %v", err)
+		}
+		if m.Current().Name() != "C" {
+			t.Fatalf("expected C, got %s", m.Current().Name())
+		}
+
+		if err := m.Reset(); err != nil {
+			t.Fatal(err)
+		}
+		if m.Completed() {
+			t.Fatal("expected Reset to re-arm the machine")
+		}
+		select {
+		case <-m.Done():
+			t.Fatal("expected a new Done channel after Reset")
+		default:
+		}
+		fire(m, 2)
+		if len(completions) != 2 {
+			t.Fatalf("expected a second completion, got %v", completions)
+		}
+	})
+
+	t.Run("done after completion", func(t *testing.T) {
+		m := mkMachine(WithTerminalEndStates())
+		fire(m, 2)
+		select {
+		case <-m.Done():
+		default:
+			t.Fatal("expected Done to be closed")
+		}
+	})
+
+	t.Run("timers stopped", func(t *testing.T) {
+		clock := newFakeClock()
+		a, b := NewState("A"), NewState("B")
+		m := NewMachine(
+			WithClock(clock),
+			WithTerminalEndStates(),
+			WithErrorHandler(func(err error) { t.Errorf("unexpected error: %v", err) }),
+			WithTransitions(
+				a.On("next").Then(b),
+				b.After(time.Minute).Then(a),
+			),
+		)
+		if err := m.SetEndStates("B"); err != nil {
+			t.Fatal(err)
+		}
+		fire(m, 1)
+		clock.Advance(time.Hour)
+		if m.Current().Name() != "B" || clock.pending() != 0 {
+			t.Fatalf("expected no timers once completed, got %s, %d pending", m.Current().Name(), clock.pending())
+		}
+	})
+
+	t.Run("restore", func(t *testing.T) {
+		m := mkMachine(WithTerminalEndStates())
+		fire(m, 2)
+		snap := m.Snapshot()
+
+		other := mkMachine(WithTerminalEndStates())
+		if err := other.Restore(snap); err != nil {
+			t.Fatal(err)
+		}
+		if !other.Completed() {
+			t.Fatal("expected restored machine to be completed")
+		}
+	})
+
+	t.Run("parallel", func(t *testing.T) {
+		finished := mkMachine(WithTerminalEndStates())
+		fire(finished, 2)
+		running := mkMachine()
+
+		p := NewParallel(WithRegion("finished", finished), WithRegion("running", running))
+		changed, err := p.Fire(context.Background(), "next", nil)
+		if !changed || err != nil {
+			t.Fatalf("unexpected result: %v, %v", changed, err)
+		}
+		if !p.In("finished", "C") || !p.In("running", "B") {
+			t.Fatalf("unexpected configuration: %v", p.Configuration())
+		}
+	})
+}
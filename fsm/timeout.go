@@ -0,0 +1,204 @@
+package fsm
+
+import (
+	"time"
+)
+
+// Clock is the source of time for a Machine. It is used to stamp history
+// entries and to run the timers of timed transitions (see State.After).
+// Tests can provide their own implementation with WithClock to advance time
+// deterministically.
+type Clock interface {
+	// Now returns the current time.
+	Now() time.Time
+	// AfterFunc waits for the duration to elapse and then calls f in its own
+	// goroutine. It returns a Timer that can be used to cancel the call.
+	AfterFunc(d time.Duration, f func()) Timer
+}
+
+// Timer is a single pending call scheduled by a Clock.
+type Timer interface {
+	// Stop prevents the Timer from firing. It returns false if the Timer has
+	// already fired or been stopped.
+	Stop() bool
+}
+
+// realClock is the Clock used by default. It is backed by the time package.
+type realClock struct{}
+
+// Now returns time.Now().
+func (realClock) Now() time.Time {
+	return time.Now()
+}
+
+// AfterFunc calls time.AfterFunc.
+func (realClock) AfterFunc(d time.Duration, f func()) Timer {
+	return time.AfterFunc(d, f)
+}
+
+// WithClock creates an Option that makes the Machine use the given Clock
+// instead of the system clock. A nil Clock is ignored.
+//
+// Example:
+//
+//	m := fsm.NewMachine(fsm.WithTransitions(t1, t2), fsm.WithClock(fakeClock))
+func WithClock(c Clock) Option {
+	return func(m *Machine) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		if c != nil {
+			m.clock = c
+		}
+	}
+}
+
+// WithErrorHandler creates an Option that sets the function called with errors
+// that cannot be returned to a caller, such as a failing hook or action of a
+// timed transition, or of an event processed by the run loop (see Run).
+// Without a handler, such errors are discarded.
+//
+// Example:
+//
+//	m := fsm.NewMachine(
+//		fsm.WithTransitions(t1, t2),
+//		fsm.WithErrorHandler(func(err error) {
+//			log.Println("fsm:", err)
+//		}),
+//	)
+func WithErrorHandler(f func(error)) Option {
+	return func(m *Machine) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+
+		m.onError = f
+	}
+}
+
+// Stop stops the timers of all timed transitions. The Machine can still be
+// updated afterwards, but timed transitions no longer fire.
+//
+// Example:
+//
+//	m := fsm.NewMachine(fsm.WithTransitions(t1, t2))
+//	defer m.Stop()
+func (m *Machine) Stop() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.cancel != nil {
+		m.cancel()
+	}
+	for id := range m.timers {
+		m.disarm(id)
+	}
+}
+
+// armed holds the timers started when a state was entered. A new value is
+// created on every entry, so a timer can tell whether its state has been left
+// since it was started.
+type armed struct {
+	timers []Timer
+}
+
+// now returns the current time according to the Machine's Clock.
+// The caller must hold m.mu.
+func (m *Machine) now() time.Time {
+	if m.clock == nil {
+		return time.Now()
+	}
+	return m.clock.Now()
+}
+
+// rearm stops all timers and starts the timers of every state on the active
+// path, as if the current state had just been entered. No timers are started
+// once the Machine has completed. The caller must hold m.mu.
+func (m *Machine) rearm() {
+	for id := range m.timers {
+		m.disarm(id)
+	}
+
+	curr := m.current()
+	if curr == nil || m.completed {
+		return
+	}
+	for _, s := range path(curr) {
+		m.arm(s)
+	}
+}
+
+// isActive reports whether s is the current state or one of its ancestors.
+// The caller must hold m.mu.
+func (m *Machine) isActive(s State) bool {
+	for curr := m.current(); curr != nil; curr = curr.Parent() {
+		if curr.Id() == s.Id() {
+			return true
+		}
+	}
+	return false
+}
+
+// arm starts the timers of the timed transitions from s. The caller must hold m.mu.
+func (m *Machine) arm(s State) {
+	for _, t := range m.transitions[s.Id()] {
+		m.startTimer(s, t)
+	}
+}
+
+// startTimer starts the timer of the timed transition t from the active state
+// s. It does nothing for other transitions. The caller must hold m.mu.
+func (m *Machine) startTimer(s State, t Transition) {
+	d := t.Timeout()
+	if d <= 0 || m.ctx == nil || m.ctx.Err() != nil {
+		return
+	}
+
+	if m.timers == nil {
+		m.timers = make(map[uint64]*armed)
+	}
+	a, ok := m.timers[s.Id()]
+	if !ok {
+		a = &armed{}
+		m.timers[s.Id()] = a
+	}
+	clock := m.clock
+	if clock == nil {
+		clock = realClock{}
+	}
+	a.timers = append(a.timers, clock.AfterFunc(d, func() {
+		m.expire(a, s, t)
+	}))
+}
+
+// disarm stops the timers started when the state with the given id was
+// entered. The caller must hold m.mu.
+func (m *Machine) disarm(id uint64) {
+	a, ok := m.timers[id]
+	if !ok {
+		return
+	}
+
+	for _, t := range a.timers {
+		t.Stop()
+	}
+	delete(m.timers, id)
+}
+
+// expire fires the timed transition t, unless s has been left since the timer
+// was started or the Machine was stopped.
+func (m *Machine) expire(a *armed, s State, t Transition) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if m.ctx.Err() != nil || m.timers[s.Id()] != a {
+		return
+	}
+
+	curr, err := m.active(m.ctx)
+	if err == nil {
+		_, err = m.commit(m.ctx, nil, curr, t)
+	}
+	if err != nil && m.onError != nil {
+		m.onError(err)
+	}
+}
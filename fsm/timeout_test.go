@@ -0,0 +1,274 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"sort"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeClock is a Clock whose time only moves when Advance is called.
+type fakeClock struct {
+	mu     sync.Mutex
+	now    time.Time
+	timers []*fakeTimer
+}
+
+type fakeTimer struct {
+	clock   *fakeClock
+	at      time.Time
+	f       func()
+	stopped bool
+}
+
+func newFakeClock() *fakeClock {
+	return &fakeClock{now: time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)}
+}
+
+func (c *fakeClock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+func (c *fakeClock) AfterFunc(d time.Duration, f func()) Timer {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	t := &fakeTimer{clock: c, at: c.now.Add(d), f: f}
+	c.timers = append(c.timers, t)
+	return t
+}
+
+// Advance moves the clock forward by d, running every timer that becomes due
+// in order.
+func (c *fakeClock) Advance(d time.Duration) {
+	c.mu.Lock()
+	end := c.now.Add(d)
+	c.mu.Unlock()
+
+	for {
+		c.mu.Lock()
+		sort.SliceStable(c.timers, func(i, j int) bool {
+			return c.timers[i].at.Before(c.timers[j].at)
+		})
+		if len(c.timers) == 0 || c.timers[0].at.After(end) {
+			c.now = end
+			c.mu.Unlock()
+			return
+		}
+		t := c.timers[0]
+		c.timers = c.timers[1:]
+		c.now = t.at
+		stopped := t.stopped
+		c.mu.Unlock()
+
+		if !stopped {
+			t.f()
+		}
+	}
+}
+
+// pending returns the number of timers that have not fired or been stopped.
+func (c *fakeClock) pending() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	n := 0
+	for _, t := range c.timers {
+		if !t.stopped {
+			n++
+		}
+	}
+	return n
+}
+
+func (t *fakeTimer) Stop() bool {
+	t.clock.mu.Lock()
+	defer t.clock.mu.Unlock()
+	was := !t.stopped
+	t.stopped = true
+	return was
+}
+
+func TestTimeout(t *testing.T) {
+	mkMachine := func(clock *fakeClock, opts ...Option) *Machine {
+		awaiting := NewState("AWAITING_PAYMENT")
+		paid := NewState("PAID")
+		expired := NewState("EXPIRED")
+		reminded := NewState("REMINDED")
+
+		return NewMachine(append([]Option{
+			WithClock(clock),
+			WithHistory(10),
+			WithTransitions(
+				awaiting.After(15*time.Minute).Then(expired),
+				awaiting.After(10*time.Minute).Then(reminded),
+				reminded.After(5*time.Minute).Then(expired),
+				awaiting.On("pay").Then(paid),
+				reminded.On("pay").Then(paid),
+			),
+		}, opts...)...)
+	}
+
+	t.Run("expires", func(t *testing.T) {
+		clock := newFakeClock()
+		m := mkMachine(clock)
+
+		clock.Advance(9 * time.Minute)
+		if m.Current().Name() != "AWAITING_PAYMENT" {
+			t.Fatalf("expected AWAITING_PAYMENT, got %s", m.Current().Name())
+		}
+		clock.Advance(time.Minute)
+		if m.Current().Name() != "REMINDED" {
+			t.Fatalf("expected REMINDED, got %s", m.Current().Name())
+		}
+		// the 15 minute timer was stopped when AWAITING_PAYMENT was left
+		clock.Advance(4 * time.Minute)
+		if m.Current().Name() != "REMINDED" {
+			t.Fatalf("expected REMINDED, got %s", m.Current().Name())
+		}
+		clock.Advance(time.Minute)
+		if m.Current().Name() != "EXPIRED" {
+			t.Fatalf("expected EXPIRED, got %s", m.Current().Name())
+		}
+
+		h := m.History()
+		if len(h) != 2 || h[1].Description != "after 5m0s" {
+			t.Fatalf("unexpected history: %+v", h)
+		}
+		if want := newFakeClock().now.Add(15 * time.Minute); !h[1].Time.Equal(want) {
+			t.Fatalf("expected time %s, got %s", want, h[1].Time)
+		}
+		if n := clock.pending(); n != 0 {
+			t.Fatalf("expected no pending timers, got %d", n)
+		}
+	})
+
+	t.Run("cancelled on exit", func(t *testing.T) {
+		clock := newFakeClock()
+		m := mkMachine(clock)
+
+		if _, err := m.Fire(context.Background(), "pay", nil); err != nil {
+			t.Fatal(err)
+		}
+		if n := clock.pending(); n != 0 {
+			t.Fatalf("expected no pending timers, got %d", n)
+		}
+		clock.Advance(time.Hour)
+		if m.Current().Name() != "PAID" {
+			t.Fatalf("expected PAID, got %s", m.Current().Name())
+		}
+	})
+
+	t.Run("update ignores timed transitions", func(t *testing.T) {
+		m := mkMachine(newFakeClock())
+		if changed, err := m.Update(context.Background(), nil); changed || err != nil {
+			t.Fatalf("unexpected result: %v, %v", changed, err)
+		}
+	})
+
+	t.Run("reset restarts timers", func(t *testing.T) {
+		clock := newFakeClock()
+		m := mkMachine(clock)
+
+		clock.Advance(10 * time.Minute)
+		if err := m.Reset(); err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(9 * time.Minute)
+		if m.Current().Name() != "AWAITING_PAYMENT" {
+			t.Fatalf("expected AWAITING_PAYMENT, got %s", m.Current().Name())
+		}
+		clock.Advance(time.Minute)
+		if m.Current().Name() != "REMINDED" {
+			t.Fatalf("expected REMINDED, got %s", m.Current().Name())
+		}
+	})
+
+	t.Run("stop", func(t *testing.T) {
+		clock := newFakeClock()
+		m := mkMachine(clock)
+
+		m.Stop()
+		if n := clock.pending(); n != 0 {
+			t.Fatalf("expected no pending timers, got %d", n)
+		}
+		clock.Advance(time.Hour)
+		if m.Current().Name() != "AWAITING_PAYMENT" {
+			t.Fatalf("expected AWAITING_PAYMENT, got %s", m.Current().Name())
+		}
+		if err := m.Reset(); err != nil {
+			t.Fatal(err)
+		}
+		if n := clock.pending(); n != 0 {
+			t.Fatalf("expected no timers after stop, got %d", n)
+		}
+	})
+
+	t.Run("error handler", func(t *testing.T) {
+		clock := newFakeClock()
+		var got error
+		m := mkMachine(clock,
+			WithOnEnter("REMINDED", func(context.Context, interface{}, State, State, Transition) error {
+				return errors.New("mail server down")
+			}),
+			WithErrorHandler(func(err error) {
+				got = err
+			}),
+		)
+
+		clock.Advance(10 * time.Minute)
+		if got == nil || got.Error() != "mail server down" {
+			t.Fatalf("expected hook error, got %v", got)
+		}
+		if m.Current().Name() != "REMINDED" {
+			t.Fatalf("expected REMINDED, got %s", m.Current().Name())
+		}
+	})
+
+	t.Run("parent timeout", func(t *testing.T) {
+		clock := newFakeClock()
+		session := NewState("SESSION")
+		idle := NewState("IDLE", WithParent(session), AsInitial())
+		busy := NewState("BUSY", WithParent(session))
+		closed := NewState("CLOSED")
+
+		m := NewMachine(WithClock(clock), WithTransitions(
+			session.After(time.Hour).Then(closed),
+			idle.On("work").Then(busy),
+			busy.On("rest").Then(idle),
+		))
+
+		// moving between children does not restart the parent's timer
+		clock.Advance(30 * time.Minute)
+		if _, err := m.Fire(context.Background(), "work", nil); err != nil {
+			t.Fatal(err)
+		}
+		clock.Advance(30 * time.Minute)
+		if m.Current().Id() != closed.Id() {
+			t.Fatalf("expected CLOSED, got %s", m.Current().Name())
+		}
+	})
+
+	t.Run("nil clock", func(t *testing.T) {
+		a, b := NewState("A"), NewState("B")
+		m := NewMachine(WithClock(nil), WithTransitions(
+			a.After(time.Hour).Then(b),
+			b.On("back").Then(a),
+		))
+		defer m.Stop()
+		if _, ok := m.clock.(realClock); !ok {
+			t.Fatalf("expected the system clock, got %T", m.clock)
+		}
+	})
+
+	t.Run("positive duration", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected panic")
+			}
+		}()
+		NewState("A").After(0)
+	})
+}
@@ -0,0 +1,231 @@
+package fsm
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// TypedTriggerFunc is the strongly typed counterpart of TriggerFunc.
+// It evaluates whether a transition should occur for a value of type V.
+type TypedTriggerFunc[V any] func(ctx context.Context, v V) (bool, error)
+
+// TypedActionFunc is the strongly typed counterpart of ActionFunc.
+type TypedActionFunc[V any] func(ctx context.Context, v V) error
+
+// Typed is a finite state Machine whose states are values of a comparable type S,
+// typically an enum, and whose update values are of type V. It is built on top of
+// Machine: each value of S is backed by a State named fmt.Sprint(s), so names
+// passed to options such as WithOnEnter, SetEndStates or LoadSpec are the
+// printed values of S. Values of S must print to distinct names.
+//
+// Example:
+//
+//	type OrderState int
+//	const (
+//		Pending OrderState = iota
+//		Paid
+//	)
+//	func (s OrderState) String() string { ... }
+//
+//	m := fsm.NewTyped[OrderState, Event]()
+//	m.When(Pending, "paid", func(ctx context.Context, e Event) (bool, error) {
+//		return e.Kind == "payment", nil
+//	}).Then(Paid)
+//
+//	changed, err := m.Update(ctx, Event{Kind: "payment"})
+//	if m.Current() == Paid { ... }
+type Typed[S comparable, V any] struct {
+	m      *Machine     // Underlying untyped machine
+	mu     sync.RWMutex // Mutex for thread-safety of the maps below
+	states map[S]State  // Backing states by value
+	values map[uint64]S // Values by backing state id
+}
+
+// NewTyped creates a new Typed machine. The options are applied to the
+// underlying Machine.
+func NewTyped[S comparable, V any](opts ...Option) *Typed[S, V] {
+	return &Typed[S, V]{
+		m:      NewMachine(opts...),
+		states: make(map[S]State),
+		values: make(map[uint64]S),
+	}
+}
+
+// Machine returns the underlying Machine, for use with the untyped API
+// such as History, Snapshot, Validate or DOT.
+func (t *Typed[S, V]) Machine() *Machine {
+	return t.m
+}
+
+// State returns the State backing s, creating it on first use.
+func (t *Typed[S, V]) State(s S) State {
+	t.mu.RLock()
+	st, ok := t.states[s]
+	t.mu.RUnlock()
+	if ok {
+		return st
+	}
+
+	t.mu.Lock()
+	defer t.mu.Unlock()
+
+	if st, ok := t.states[s]; ok {
+		return st
+	}
+	st = NewState(fmt.Sprint(s))
+	t.states[s] = st
+	t.values[st.Id()] = s
+
+	return st
+}
+
+// value returns the value of S backing st.
+func (t *Typed[S, V]) value(st State) (S, bool) {
+	t.mu.RLock()
+	defer t.mu.RUnlock()
+
+	if st == nil {
+		var zero S
+		return zero, false
+	}
+	s, ok := t.values[st.Id()]
+	return s, ok
+}
+
+// When creates a new transition from the state from with the specified condition.
+// The transition is added to the machine when its destination is set with Then.
+// As with Machine.AddTransition, the source of the first transition becomes the
+// start state. A nil value is passed to f as the zero V.
+// Panics if f is nil.
+func (t *Typed[S, V]) When(from S, desc string, f TypedTriggerFunc[V]) *TypedTransition[S, V] {
+	if f == nil {
+		panic("trigger function must not be nil")
+	}
+
+	tr := t.State(from).When(desc, func(ctx context.Context, v interface{}) (bool, error) {
+		if v == nil {
+			var zero V
+			return f(ctx, zero)
+		}
+		tv, ok := v.(V)
+		if !ok {
+			return false, fmt.Errorf("unexpected value type %T", v)
+		}
+		return f(ctx, tv)
+	})
+
+	return &TypedTransition[S, V]{typed: t, t: tr}
+}
+
+// On creates a new transition from the state from that fires on the specified
+// event. See State.On and Fire.
+func (t *Typed[S, V]) On(from S, trigger Trigger) *TypedTransition[S, V] {
+	return &TypedTransition[S, V]{typed: t, t: t.State(from).On(trigger)}
+}
+
+// After creates a new transition from the state from that fires once the state
+// has been active for d. See State.After.
+func (t *Typed[S, V]) After(from S, d time.Duration) *TypedTransition[S, V] {
+	return &TypedTransition[S, V]{typed: t, t: t.State(from).After(d)}
+}
+
+// SetStart sets the start state of the machine, which also becomes the current state.
+func (t *Typed[S, V]) SetStart(s S) error {
+	return t.m.SetStart(t.State(s).Name())
+}
+
+// SetEndStates sets the end states of the machine.
+func (t *Typed[S, V]) SetEndStates(states ...S) error {
+	names := make([]string, len(states))
+	for i, s := range states {
+		names[i] = t.State(s).Name()
+	}
+	return t.m.SetEndStates(names...)
+}
+
+// Current returns the current state of the machine, or the zero value
+// of S if the machine has no transitions.
+func (t *Typed[S, V]) Current() S {
+	s, _ := t.value(t.m.Current())
+	return s
+}
+
+// Is reports whether the machine is currently in state s.
+func (t *Typed[S, V]) Is(s S) bool {
+	curr, ok := t.value(t.m.Current())
+	return ok && curr == s
+}
+
+// IsEndState checks if the current state is an end state.
+func (t *Typed[S, V]) IsEndState() bool {
+	return t.m.IsEndState()
+}
+
+// Reset resets the machine to its start state.
+func (t *Typed[S, V]) Reset() error {
+	return t.m.Reset()
+}
+
+// Validate validates the machine configuration. See Machine.Validate.
+func (t *Typed[S, V]) Validate() error {
+	return t.m.Validate()
+}
+
+// Update updates the machine state based on the provided value.
+// See Machine.Update.
+func (t *Typed[S, V]) Update(ctx context.Context, v V) (bool, error) {
+	return t.m.Update(ctx, v)
+}
+
+// Fire updates the machine state in response to a named event.
+// See Machine.Fire.
+func (t *Typed[S, V]) Fire(ctx context.Context, trigger Trigger, v V) (bool, error) {
+	return t.m.Fire(ctx, trigger, v)
+}
+
+// TypedTransition is a transition of a Typed machine that is being defined.
+type TypedTransition[S comparable, V any] struct {
+	typed *Typed[S, V]
+	t     Transition
+}
+
+// Do sets the action run when the transition fires. See Transition.Do.
+// Timed transitions fire without a value; their action receives the zero V.
+func (tt *TypedTransition[S, V]) Do(f TypedActionFunc[V]) *TypedTransition[S, V] {
+	tt.t.Do(func(ctx context.Context, v interface{}) error {
+		if v == nil {
+			var zero V
+			return f(ctx, zero)
+		}
+		tv, ok := v.(V)
+		if !ok {
+			return fmt.Errorf("unexpected value type %T", v)
+		}
+		return f(ctx, tv)
+	})
+
+	return tt
+}
+
+// Prioritize sets the priority of the transition. See Transition.Prioritize.
+func (tt *TypedTransition[S, V]) Prioritize(p int) *TypedTransition[S, V] {
+	tt.t.Prioritize(p)
+	return tt
+}
+
+// On keys the transition by the specified event. See Transition.On.
+func (tt *TypedTransition[S, V]) On(trigger Trigger) *TypedTransition[S, V] {
+	tt.t.On(trigger)
+	return tt
+}
+
+// Then sets the destination state of the transition, adds it to the machine
+// and returns the underlying Transition.
+func (tt *TypedTransition[S, V]) Then(to S) Transition {
+	tr := tt.t.Then(tt.typed.State(to))
+	tt.typed.m.AddTransition(tr)
+
+	return tr
+}
@@ -0,0 +1,176 @@
+package fsm
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type orderState int
+
+const (
+	orderPending orderState = iota
+	orderPaid
+	orderShipped
+	orderCancelled
+)
+
+func (s orderState) String() string {
+	switch s {
+	case orderPending:
+		return "PENDING"
+	case orderPaid:
+		return "PAID"
+	case orderShipped:
+		return "SHIPPED"
+	case orderCancelled:
+		return "CANCELLED"
+	}
+	return "UNKNOWN"
+}
+
+type orderEvent struct {
+	kind   string
+	amount int
+}
+
+func TestTyped(t *testing.T) {
+	is := func(kind string) TypedTriggerFunc[orderEvent] {
+		return func(_ context.Context, e orderEvent) (bool, error) {
+			return e.kind == kind, nil
+		}
+	}
+
+	mkMachine := func(t *testing.T) (*Typed[orderState, orderEvent], *int) {
+		t.Helper()
+
+		var charged int
+		m := NewTyped[orderState, orderEvent](WithHistory(10))
+		m.When(orderPending, "paid", is("pay")).Do(func(_ context.Context, e orderEvent) error {
+			if e.amount <= 0 {
+				return errors.New("nothing to charge")
+			}
+			charged += e.amount
+			return nil
+		}).Then(orderPaid)
+		m.When(orderPending, "cancelled", is("cancel")).Then(orderCancelled)
+		m.When(orderPaid, "shipped", is("ship")).Then(orderShipped)
+
+		if err := m.SetEndStates(orderShipped, orderCancelled); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Validate(); err != nil {
+			t.Fatal(err)
+		}
+		return m, &charged
+	}
+
+	t.Run("update", func(t *testing.T) {
+		m, charged := mkMachine(t)
+		ctx := context.Background()
+
+		if m.Current() != orderPending {
+			t.Fatalf("expected PENDING, got %s", m.Current())
+		}
+		if _, err := m.Update(ctx, orderEvent{kind: "pay"}); err == nil {
+			t.Fatal("expected action error")
+		}
+		if !m.Is(orderPending) {
+			t.Fatal("expected PENDING")
+		}
+
+		for _, e := range []orderEvent{{kind: "pay", amount: 42}, {kind: "ship"}} {
+			if changed, err := m.Update(ctx, e); !changed || err != nil {
+				t.Fatalf("unexpected result: %v, %v", changed, err)
+			}
+		}
+		if m.Current() != orderShipped || !m.IsEndState() {
+			t.Fatalf("expected end state SHIPPED, got %s", m.Current())
+		}
+		if *charged != 42 {
+			t.Fatalf("expected 42 charged, got %d", *charged)
+		}
+		if h := m.Machine().History(); len(h) != 2 || h[1].To != "SHIPPED" {
+			t.Fatalf("unexpected history: %+v", h)
+		}
+	})
+
+	t.Run("start and reset", func(t *testing.T) {
+		m, _ := mkMachine(t)
+
+		if err := m.SetStart(orderPaid); err != nil {
+			t.Fatal(err)
+		}
+		if m.Current() != orderPaid {
+			t.Fatalf("expected PAID, got %s", m.Current())
+		}
+		if _, err := m.Update(context.Background(), orderEvent{kind: "ship"}); err != nil {
+			t.Fatal(err)
+		}
+		if err := m.Reset(); err != nil {
+			t.Fatal(err)
+		}
+		if m.Current() != orderPaid {
+			t.Fatalf("expected PAID, got %s", m.Current())
+		}
+	})
+
+	t.Run("state identity", func(t *testing.T) {
+		m, _ := mkMachine(t)
+		if m.State(orderPaid).Id() != m.State(orderPaid).Id() {
+			t.Fatal("expected a single state per value")
+		}
+		if m.State(orderPaid).Name() != "PAID" {
+			t.Fatalf("unexpected name: %s", m.State(orderPaid).Name())
+		}
+	})
+
+	t.Run("fire", func(t *testing.T) {
+		m, _ := mkMachine(t)
+		m.On(orderPaid, "refund").Then(orderCancelled)
+		m.When(orderPaid, "partial refund", func(_ context.Context, e orderEvent) (bool, error) {
+			return e.amount < 10, nil
+		}).On("partial").Then(orderPending)
+
+		ctx := context.Background()
+		if _, err := m.Update(ctx, orderEvent{kind: "pay", amount: 20}); err != nil {
+			t.Fatal(err)
+		}
+		if changed, err := m.Fire(ctx, "partial", orderEvent{amount: 50}); changed || err != nil {
+			t.Fatalf("unexpected result: %v, %v", changed, err)
+		}
+		if changed, err := m.Fire(ctx, "refund", orderEvent{}); !changed || err != nil {
+			t.Fatalf("unexpected result: %v, %v", changed, err)
+		}
+		if m.Current() != orderCancelled {
+			t.Fatalf("expected CANCELLED, got %s", m.Current())
+		}
+	})
+
+	t.Run("untyped update", func(t *testing.T) {
+		m, _ := mkMachine(t)
+		if _, err := m.Machine().Update(context.Background(), "pay"); err == nil {
+			t.Fatal("expected type error")
+		}
+	})
+
+	t.Run("nil value", func(t *testing.T) {
+		m := NewTyped[orderState, error]()
+		m.When(orderPending, "ok", func(_ context.Context, err error) (bool, error) {
+			return err == nil, nil
+		}).Then(orderPaid)
+
+		if changed, err := m.Update(context.Background(), nil); !changed || err != nil {
+			t.Fatalf("unexpected result: %v, %v", changed, err)
+		}
+	})
+
+	t.Run("nil trigger", func(t *testing.T) {
+		defer func() {
+			if recover() == nil {
+				t.Fatal("expected panic")
+			}
+		}()
+		NewTyped[orderState, orderEvent]().When(orderPending, "paid", nil)
+	})
+}
@@ -1,5 +1,5 @@
 module github.com/twlvprscs/state
 
-go 1.15
+go 1.18
 
 require github.com/schigh/slice v1.0.2
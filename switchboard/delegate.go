@@ -3,27 +3,45 @@ package switchboard
 import (
 	"context"
 	"fmt"
+	"sort"
 	"strings"
 )
 
 type delegate struct {
 	locker     chan struct{}
+	pusher     chan struct{}
 	changeChan chan change
-	reg        register
+	done       chan struct{}
+	started    bool // Whether Run has ever been called
+	policy     BackpressurePolicy
+	seq        uint64
+	signals    []*Signal
+	names      map[string]uint
+	labels     map[uint]string
+	reg        register // States of the indices below maxReg
+	dynamic    bool
+	pages      map[uint]*register // States of the indices from maxReg on, by page, when dynamic
+	fill       uint64             // Value of every word of a new page
 }
 
 type change struct {
 	ctx    context.Context
 	state  uint
 	closed bool
+	seq    uint64
+	signal *Signal
 }
 
 func newDelegate() *delegate {
 	sem := make(chan struct{}, 1)
 	sem <- struct{}{}
+	push := make(chan struct{}, 1)
+	push <- struct{}{}
 	return &delegate{
 		locker:     sem,
-		changeChan: make(chan change),
+		pusher:     push,
+		changeChan: make(chan change, DefaultQueueSize),
+		done:       make(chan struct{}),
 	}
 }
 
@@ -36,82 +54,445 @@ func (d *delegate) unlock() {
 	d.locker <- struct{}{}
 }
 
-func (d *delegate) close(ctx context.Context, indices ...uint) {
+func (d *delegate) close(ctx context.Context, indices ...uint) error {
+	return d.set(ctx, true, indices)
+}
+
+func (d *delegate) open(ctx context.Context, indices ...uint) error {
+	return d.set(ctx, false, indices)
+}
+
+// set closes or opens the indices and queues a change for each index that
+// changed state.
+func (d *delegate) set(ctx context.Context, closed bool, indices []uint) error {
 	select {
 	case <-ctx.Done():
-		return
+		return ctx.Err()
 	default:
 	}
 
-	defer d.lock().unlock()
+	if err := d.begin(ctx); err != nil {
+		return err
+	}
+	if err := d.check(indices); err != nil {
+		d.abort()
+		return err
+	}
 
 	var changes []uint
-	var r register
-	r, changes = registerClose(d.reg, indices...)
-	d.reg = r
+	switch {
+	case fits(indices) && closed:
+		d.reg, changes = registerClose(d.reg, indices...)
+	case fits(indices):
+		d.reg, changes = registerOpen(d.reg, indices...)
+	default:
+		changes = make([]uint, 0, len(indices))
+		for i := 0; i < len(indices); i++ {
+			r, offs := d.page(indices[i])
+			var changed []uint
+			if closed {
+				*r, changed = registerClose(*r, offs)
+			} else {
+				*r, changed = registerOpen(*r, offs)
+			}
+			if len(changed) > 0 {
+				changes = append(changes, indices[i])
+			}
+		}
+	}
 
+	out := make([]change, len(changes))
 	for i := 0; i < len(changes); i++ {
-		go d.pushChange(ctx, changes[i], true)
+		out[i] = d.mkChange(ctx, changes[i], closed)
 	}
+
+	d.push(d.evaluate(ctx, out))
+	return nil
 }
 
-func (d *delegate) open(ctx context.Context, indices ...uint) {
+func (d *delegate) toggle(ctx context.Context, indices ...uint) error {
 	select {
 	case <-ctx.Done():
-		return
+		return ctx.Err()
 	default:
 	}
 
-	defer d.lock().unlock()
+	if err := d.begin(ctx); err != nil {
+		return err
+	}
+	if err := d.check(indices); err != nil {
+		d.abort()
+		return err
+	}
 
-	var changes []uint
-	var r register
-	r, changes = registerOpen(d.reg, indices...)
-	d.reg = r
+	// toggle one index at a time, so that changes are queued in the order
+	// the indices were given, even if an index is given more than once
+	out := make([]change, 0, len(indices))
+	for i := 0; i < len(indices); i++ {
+		r, offs := d.page(indices[i])
+		var closed []uint
+		*r, closed, _ = registerToggle(*r, offs)
+		out = append(out, d.mkChange(ctx, indices[i], len(closed) > 0))
+	}
+
+	d.push(d.evaluate(ctx, out))
+	return nil
+}
+
+// begin takes the pusher, then the lock, so that changes are queued in the
+// order they are made, while a caller waiting for room in the queue never holds
+// the lock. It returns ctx.Err() if ctx is done before the pusher is taken.
+func (d *delegate) begin(ctx context.Context) error {
+	select {
+	case <-ctx.Done():
+		return ctx.Err()
+	case <-d.pusher:
+	}
+	d.lock()
+
+	return nil
+}
+
+// abort releases the lock and the pusher taken by begin.
+func (d *delegate) abort() {
+	d.unlock()
+	d.pusher <- struct{}{}
+}
+
+// check returns an error if an index does not fit in a fixed-size register.
+// The caller must hold the lock.
+func (d *delegate) check(indices []uint) error {
+	if d.dynamic {
+		return nil
+	}
+	for i := 0; i < len(indices); i++ {
+		if indices[i] >= maxReg {
+			return fmt.Errorf("%w: %d (the register holds %d indices)", ErrOutOfRange, indices[i], maxReg)
+		}
+	}
+
+	return nil
+}
+
+// page returns the register holding idx and the index within it, adding the
+// page if needed. The index must have passed check. The caller must hold the lock.
+func (d *delegate) page(idx uint) (*register, uint) {
+	if idx < maxReg {
+		return &d.reg, idx
+	}
+
+	n := idx / maxReg
+	r, ok := d.pages[n]
+	if !ok {
+		if d.pages == nil {
+			d.pages = make(map[uint]*register)
+		}
+		r = new(register)
+		for i := 0; i < capacity; i++ {
+			r[i] = d.fill
+		}
+		d.pages[n] = r
+	}
+
+	return r, idx % maxReg
+}
+
+// closed reports whether idx is in the closed state. Indices beyond a
+// fixed-size register are open, and indices of pages not added yet have their
+// initial state. The caller must hold the lock.
+func (d *delegate) closed(idx uint) bool {
+	if idx < maxReg {
+		return registerClosed(d.reg, idx)
+	}
+	if r, ok := d.pages[idx/maxReg]; ok {
+		return registerClosed(*r, idx%maxReg)
+	}
+
+	return d.dynamic && d.fill != 0
+}
+
+// all reports whether all the indices are in the given state.
+// The caller must hold the lock.
+func (d *delegate) all(closed bool, indices []uint) bool {
+	if fits(indices) {
+		if closed {
+			return registerAllClosed(d.reg, indices...)
+		}
+		return registerAllOpened(d.reg, indices...)
+	}
+
+	for i := 0; i < len(indices); i++ {
+		if d.closed(indices[i]) != closed {
+			return false
+		}
+	}
+
+	return true
+}
+
+// any reports whether any of the indices is in the given state.
+// The caller must hold the lock.
+func (d *delegate) any(closed bool, indices []uint) bool {
+	if fits(indices) {
+		if closed {
+			return registerAnyClosed(d.reg, indices...)
+		}
+		return registerAnyOpened(d.reg, indices...)
+	}
+
+	for i := 0; i < len(indices); i++ {
+		if d.closed(indices[i]) == closed {
+			return true
+		}
+	}
+
+	return false
+}
+
+// sortedPages returns the numbers of the pages added beyond the first register,
+// in ascending order. The caller must hold the lock.
+func (d *delegate) sortedPages() []uint {
+	out := make([]uint, 0, len(d.pages))
+	for n := range d.pages {
+		out = append(out, n)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i] < out[j] })
+
+	return out
+}
+
+// mkChange numbers a change. The caller must hold the lock.
+func (d *delegate) mkChange(ctx context.Context, state uint, closed bool) change {
+	d.seq++
+	return change{ctx: ctx, state: state, closed: closed, seq: d.seq}
+}
+
+// evaluate appends a numbered change for every signal that became active or
+// inactive to changes. The caller must hold the lock.
+func (d *delegate) evaluate(ctx context.Context, changes []change) []change {
+	if len(changes) == 0 {
+		return changes
+	}
+
+	for _, sig := range d.signals {
+		active := sig.eval(d)
+		if active == sig.active {
+			continue
+		}
+		sig.active = active
+		c := d.mkChange(ctx, 0, active)
+		c.signal = sig
+		changes = append(changes, c)
+	}
+
+	return changes
+}
+
+// push releases the lock taken by begin, queues changes in order and then
+// releases the pusher. Later calls wait for the pusher, so their changes are
+// queued after these, while queries only need the lock and are not blocked by
+// a full queue.
+func (d *delegate) push(changes []change) {
+	done, started := d.done, d.started
+	d.unlock()
+	defer func() {
+		d.pusher <- struct{}{}
+	}()
 
 	for i := 0; i < len(changes); i++ {
-		go d.pushChange(ctx, changes[i], false)
+		d.pushChange(changes[i], done, started)
 	}
 }
 
-func (d *delegate) toggle(ctx context.Context, indices ...uint) {
+// pushChange queues a single change according to the backpressure policy.
+// Changes are discarded once the switchboard has shut down. Until Run is first
+// called, Block discards the oldest queued change instead of waiting, so that
+// a switchboard that is never run does not block.
+func (d *delegate) pushChange(c change, done chan struct{}, started bool) {
 	select {
-	case <-ctx.Done():
+	case <-done:
 		return
 	default:
 	}
 
+	policy := d.policy
+	if policy == Block && !started {
+		policy = DropOldest
+	}
+
+	switch policy {
+	case DropNewest:
+		select {
+		case d.changeChan <- c:
+		default:
+		}
+	case DropOldest:
+		for {
+			select {
+			case d.changeChan <- c:
+				return
+			default:
+			}
+			select {
+			case <-d.changeChan:
+			default:
+			}
+		}
+	default:
+		select {
+		case d.changeChan <- c:
+		case <-c.ctx.Done():
+		case <-done:
+		}
+	}
+}
+
+// shutdown discards queued changes and makes later changes be discarded,
+// until the switchboard is run again.
+func (d *delegate) shutdown() {
+	d.lock()
+	close(d.done)
+	d.unlock()
+
+	// wait for changes being pushed, which now give up
+	<-d.pusher
+	defer func() {
+		d.pusher <- struct{}{}
+	}()
+
+	for {
+		select {
+		case <-d.changeChan:
+		default:
+			return
+		}
+	}
+}
+
+// restart makes a switchboard that was shut down accept changes again.
+func (d *delegate) restart() {
 	defer d.lock().unlock()
 
-	var opened, closed []uint
-	var r register
-	r, closed, opened = registerToggle(d.reg, indices...)
-	d.reg = r
+	d.started = true
 
-	for i := 0; i < len(closed); i++ {
-		go d.pushChange(ctx, closed[i], true)
+	select {
+	case <-d.done:
+		d.done = make(chan struct{})
+	default:
 	}
-	for i := 0; i < len(opened); i++ {
-		go d.pushChange(ctx, opened[i], false)
+}
+
+func (d *delegate) query(f func(*delegate) bool) bool {
+	defer d.lock().unlock()
+	return f(d)
+}
+
+func (d *delegate) indices(f func(register) []uint) []uint {
+	defer d.lock().unlock()
+	return d.collect(f)
+}
+
+// collect returns the indices selected by f from every register, in ascending
+// order. The caller must hold the lock.
+func (d *delegate) collect(f func(register) []uint) []uint {
+	out := f(d.reg)
+	for _, n := range d.sortedPages() {
+		for _, idx := range f(*d.pages[n]) {
+			out = append(out, n*maxReg+idx)
+		}
 	}
+
+	return out
 }
 
-func (d *delegate) pushChange(ctx context.Context, state uint, closed bool) {
-	d.changeChan <- change{ctx, state, closed}
+func (d *delegate) define(name string) (uint, error) {
+	defer d.lock().unlock()
+
+	if _, ok := d.names[name]; ok {
+		return 0, fmt.Errorf("%w: '%s'", ErrDuplicateName, name)
+	}
+	idx := uint(len(d.names))
+	if !d.dynamic && idx >= maxReg {
+		return 0, ErrRegisterFull
+	}
+
+	if d.names == nil {
+		d.names = make(map[string]uint)
+		d.labels = make(map[uint]string)
+	}
+	d.names[name] = idx
+	d.labels[idx] = name
+
+	return idx, nil
+}
+
+func (d *delegate) index(name string) (uint, bool) {
+	defer d.lock().unlock()
+	idx, ok := d.names[name]
+	return idx, ok
+}
+
+func (d *delegate) name(idx uint) (string, bool) {
+	defer d.lock().unlock()
+	name, ok := d.labels[idx]
+	return name, ok
 }
 
 func (d *delegate) reset() {
 	defer d.lock().unlock()
 	d.reg = register{}
+	d.pages = nil
+	d.fill = 0
+	for _, sig := range d.signals {
+		sig.active = sig.eval(d)
+	}
 }
 
 func (d *delegate) stringVal() string {
 	defer d.lock().unlock()
 	sb := strings.Builder{}
 
+	// pages are printed like the first register, most significant word first,
+	// with the number of the word across all pages
+	pages := d.sortedPages()
+	for p := len(pages) - 1; p >= 0; p-- {
+		r := d.pages[pages[p]]
+		for i := capacity - 1; i >= 0; i-- {
+			sb.WriteString(fmt.Sprintf("%-5d%064b\n", pages[p]*capacity+uint(i), r[i]))
+		}
+	}
 	for i := capacity - 1; i >= 0; i-- {
 		sb.WriteString(fmt.Sprintf("%-5d%064b\n", i, d.reg[i]))
 	}
+	for idx := uint(0); idx < uint(len(d.labels)); idx++ {
+		sb.WriteString(fmt.Sprintf("%-5d%s=%s\n", idx, d.labels[idx], stateName(d.closed(idx))))
+	}
+
+	return sb.String()
+}
+
+// humanVal lists every named condition with its state, followed by the
+// closed conditions that have no name.
+func (d *delegate) humanVal() string {
+	defer d.lock().unlock()
+	sb := strings.Builder{}
+
+	for idx := uint(0); idx < uint(len(d.labels)); idx++ {
+		sb.WriteString(fmt.Sprintf("%s: %s\n", d.labels[idx], stateName(d.closed(idx))))
+	}
+	for _, idx := range d.collect(registerClosedIndices) {
+		if _, ok := d.labels[idx]; !ok {
+			sb.WriteString(fmt.Sprintf("%d: %s\n", idx, stateName(true)))
+		}
+	}
 
 	return sb.String()
 }
+
+// stateName returns the name of a state in human-readable output.
+func stateName(closed bool) string {
+	if closed {
+		return "closed"
+	}
+	return "open"
+}
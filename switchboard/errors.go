@@ -0,0 +1,17 @@
+package switchboard
+
+import (
+	"errors"
+)
+
+var (
+	// ErrDuplicateName is returned by Define for a name that is already defined.
+	ErrDuplicateName = errors.New("switchboard: duplicate name")
+	// ErrUndefinedName is returned by Lookup for a name that was never defined.
+	ErrUndefinedName = errors.New("switchboard: undefined name")
+	// ErrRegisterFull is returned by Define when every index is in use.
+	ErrRegisterFull = errors.New("switchboard: no free index")
+	// ErrOutOfRange is returned by Open, Close and Toggle for an index beyond
+	// the register of a switchboard created without WithDynamicRegister.
+	ErrOutOfRange = errors.New("switchboard: index out of range")
+)
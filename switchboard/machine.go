@@ -1,13 +1,55 @@
 // Package switchboard provides a high-performance, concurrent-safe mechanism for
 // managing binary states (open/closed) and triggering events when those states change.
-// It efficiently handles up to 4096 different states using bit manipulation.
+// It efficiently handles up to 4096 different states using bit manipulation, or
+// any number of states when created with WithDynamicRegister.
 package switchboard
 
 import (
 	"context"
 	"fmt"
+	"math"
+	"sync"
 )
 
+// DefaultQueueSize is the number of changes a switchboard created without
+// WithQueueSize can hold before its BackpressurePolicy applies.
+const DefaultQueueSize = 4096
+
+// BackpressurePolicy determines what happens to a change when the queue of
+// changes waiting for the handlers is full.
+type BackpressurePolicy int
+
+const (
+	// Block makes Open, Close and Toggle wait until there is room in the queue,
+	// which is only made while Run is running. The change is discarded if their
+	// context is done first. Until Run is first called, nothing waits: the
+	// oldest queued change is discarded instead, as for DropOldest.
+	Block BackpressurePolicy = iota
+	// DropNewest discards the change that does not fit.
+	DropNewest
+	// DropOldest discards the oldest queued change to make room.
+	DropOldest
+)
+
+// seqKey is the context key of the sequence number of a change.
+type seqKey struct{}
+
+// SequenceFromContext returns the sequence number of the change being handled,
+// from the context passed to a ChangeHandler or SingleStateChangeHandler.
+// Every change is numbered when it is made, starting at 1, in the order
+// handlers receive them; a gap means changes were discarded.
+//
+// Example:
+//
+//	switchboard.WithDefaultChangeHandler(func(ctx context.Context, idx uint, closed bool) {
+//		seq, _ := switchboard.SequenceFromContext(ctx)
+//		log.Printf("#%d: %d closed=%v", seq, idx, closed)
+//	})
+func SequenceFromContext(ctx context.Context) (uint64, bool) {
+	seq, ok := ctx.Value(seqKey{}).(uint64)
+	return seq, ok
+}
+
 // ChangeHandler is a function that handles state changes for any condition.
 // It receives the context, the index of the changed state, and whether it was closed (true) or opened (false).
 type ChangeHandler func(ctx context.Context, idx uint, state bool)
@@ -21,16 +63,32 @@ type Switch interface {
 	fmt.GoStringer
 	// Open sets the specified conditions to the open state.
 	// If a condition changes state, registered handlers will be notified.
-	Open(ctx context.Context, conditions ...uint)
+	Open(ctx context.Context, conditions ...uint) error
 	// Close sets the specified conditions to the closed state.
 	// If a condition changes state, registered handlers will be notified.
-	Close(ctx context.Context, conditions ...uint)
+	Close(ctx context.Context, conditions ...uint) error
 	// Toggle switches the state of the specified conditions.
 	// If a condition changes state, registered handlers will be notified.
-	Toggle(ctx context.Context, conditions ...uint)
+	Toggle(ctx context.Context, conditions ...uint) error
 	// Run starts the state machine, enabling it to process state changes and notify handlers.
 	// This method should be called before using the state machine.
 	Run(ctx context.Context)
+	// IsClosed reports whether the specified condition is in the closed state.
+	IsClosed(condition uint) bool
+	// IsOpened reports whether the specified condition is in the open state.
+	IsOpened(condition uint) bool
+	// AllClosed reports whether all the specified conditions are in the closed state.
+	AllClosed(conditions ...uint) bool
+	// AnyClosed reports whether any of the specified conditions is in the closed state.
+	AnyClosed(conditions ...uint) bool
+	// AllOpened reports whether all the specified conditions are in the open state.
+	AllOpened(conditions ...uint) bool
+	// AnyOpened reports whether any of the specified conditions is in the open state.
+	AnyOpened(conditions ...uint) bool
+	// Closed returns the conditions that are in the closed state, in ascending order.
+	Closed() []uint
+	// Opened returns the conditions that are in the open state, in ascending order.
+	Opened() []uint
 }
 
 // S is the main implementation of the Switch interface.
@@ -39,6 +97,14 @@ type S struct {
 	delegate      *delegate
 	defaultChange func(context.Context, uint, bool)
 	changeMap     map[uint]func(context.Context, bool)
+	mu            sync.Mutex // Guards loop
+	loop          *runLoop   // Loop started by the last call to Run, if any
+}
+
+// runLoop is a delivery loop started by Run.
+type runLoop struct {
+	ctx    context.Context // Context the loop runs until
+	exited chan struct{}   // Closed once the loop has returned
 }
 
 // Ensure S implements the Switch interface
@@ -69,6 +135,40 @@ func WithAllStatesClosed() Option {
 	return func(s *S) {
 		defer s.delegate.lock().unlock()
 		s.delegate.reg = registerWithAllClosed()
+		s.delegate.fill = math.MaxUint64
+	}
+}
+
+// WithQueueSize sets the number of changes that can wait for the handlers
+// before the BackpressurePolicy applies. The default is DefaultQueueSize;
+// sizes below 1 are treated as 1.
+func WithQueueSize(size int) Option {
+	return func(s *S) {
+		if size < 1 {
+			size = 1
+		}
+		s.delegate.changeChan = make(chan change, size)
+	}
+}
+
+// WithBackpressure sets what happens to a change when the queue is full.
+// The default is Block. Under Block, handlers that change the switchboard can
+// deadlock when the queue is full, as the queue is only drained between handlers.
+func WithBackpressure(policy BackpressurePolicy) Option {
+	return func(s *S) {
+		s.delegate.policy = policy
+	}
+}
+
+// WithDynamicRegister lets the switchboard track any number of states. The
+// first 4096 states are kept in a fixed-size register as usual; states from
+// index 4096 on are kept in pages of 4096 states, added when one of their
+// states is first changed. Without this option, Open, Close and Toggle return
+// ErrOutOfRange for indices from 4096 on.
+func WithDynamicRegister() Option {
+	return func(s *S) {
+		defer s.delegate.lock().unlock()
+		s.delegate.dynamic = true
 	}
 }
 
@@ -89,20 +189,54 @@ func New(opts ...Option) *S {
 }
 
 // Run starts the state machine, enabling it to process state changes and notify handlers.
-// It launches a goroutine that listens for state changes and calls the appropriate handlers.
-// The goroutine will run until the provided context is canceled.
+// It launches a goroutine that takes changes from the queue and calls the appropriate
+// handlers one at a time, in the order the changes were made. Changes made before Run
+// is called are queued and delivered once it is.
+// The goroutine will run until the provided context is canceled; changes still queued
+// then, or made afterwards, are discarded until Run is called again. Calling Run while
+// the goroutine is running has no effect. Once its context is canceled, Run starts a
+// new goroutine, which waits for the previous one to return before delivering changes.
 func (s *S) Run(ctx context.Context) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	prev := s.loop
+	if prev != nil && prev.ctx.Err() == nil {
+		return
+	}
+	l := &runLoop{ctx: ctx, exited: make(chan struct{})}
+	s.loop = l
+	s.delegate.restart()
+
 	go func(ctx context.Context, s *S) {
+		defer close(l.exited)
+		defer func() {
+			// a loop replaced by a later Run leaves the queue to it
+			s.mu.Lock()
+			defer s.mu.Unlock()
+			if s.loop == l {
+				s.delegate.shutdown()
+			}
+		}()
+
+		if prev != nil {
+			<-prev.exited
+		}
 		for {
 			select {
 			case <-ctx.Done():
 				return
 			case c := <-s.delegate.changeChan:
+				cctx := context.WithValue(c.ctx, seqKey{}, c.seq)
+				if c.signal != nil {
+					c.signal.notify(cctx, c.closed)
+					continue
+				}
 				if f, ok := s.changeMap[c.state]; ok {
-					f(c.ctx, c.closed)
+					f(cctx, c.closed)
 					continue
 				}
-				s.defaultChange(c.ctx, c.state, c.closed)
+				s.defaultChange(cctx, c.state, c.closed)
 			}
 		}
 	}(ctx, s)
@@ -110,28 +244,118 @@ func (s *S) Run(ctx context.Context) {
 
 // Close sets the specified conditions to the closed state.
 // If a condition changes state, registered handlers will be notified.
+// The changes are queued before Close returns; see WithBackpressure for what
+// happens when the queue is full.
+// It returns ctx.Err() if ctx is done before the states are changed, and an
+// error wrapping ErrOutOfRange, without changing any state, if a condition does
+// not fit in the register; see WithDynamicRegister.
 // This method is safe for concurrent use.
-func (s *S) Close(ctx context.Context, conditions ...uint) {
-	s.delegate.close(ctx, conditions...)
+func (s *S) Close(ctx context.Context, conditions ...uint) error {
+	return s.delegate.close(ctx, conditions...)
 }
 
 // Open sets the specified conditions to the open state.
 // If a condition changes state, registered handlers will be notified.
+// It returns the same errors as Close.
 // This method is safe for concurrent use.
-func (s *S) Open(ctx context.Context, conditions ...uint) {
-	s.delegate.open(ctx, conditions...)
+func (s *S) Open(ctx context.Context, conditions ...uint) error {
+	return s.delegate.open(ctx, conditions...)
 }
 
 // Toggle switches the state of the specified conditions.
 // If a condition is open, it will be closed, and vice versa.
 // Registered handlers will be notified of any state changes.
+// It returns the same errors as Close.
+// This method is safe for concurrent use.
+func (s *S) Toggle(ctx context.Context, conditions ...uint) error {
+	return s.delegate.toggle(ctx, conditions...)
+}
+
+// IsClosed reports whether the specified condition is in the closed state.
+// Conditions that do not fit in the register are open.
+// This method is safe for concurrent use.
+func (s *S) IsClosed(condition uint) bool {
+	return s.delegate.query(func(d *delegate) bool {
+		return d.closed(condition)
+	})
+}
+
+// IsOpened reports whether the specified condition is in the open state.
+// This method is safe for concurrent use.
+func (s *S) IsOpened(condition uint) bool {
+	return s.delegate.query(func(d *delegate) bool {
+		return !d.closed(condition)
+	})
+}
+
+// AllClosed reports whether all the specified conditions are in the closed state.
+// It returns true if no conditions are given.
+// The conditions are read at a single point in time. This method is safe for concurrent use.
+func (s *S) AllClosed(conditions ...uint) bool {
+	return s.delegate.query(func(d *delegate) bool {
+		return d.all(true, conditions)
+	})
+}
+
+// AnyClosed reports whether any of the specified conditions is in the closed state.
+// It returns false if no conditions are given.
+// The conditions are read at a single point in time. This method is safe for concurrent use.
+func (s *S) AnyClosed(conditions ...uint) bool {
+	return s.delegate.query(func(d *delegate) bool {
+		return d.any(true, conditions)
+	})
+}
+
+// AllOpened reports whether all the specified conditions are in the open state.
+// It returns true if no conditions are given.
+// The conditions are read at a single point in time. This method is safe for concurrent use.
+func (s *S) AllOpened(conditions ...uint) bool {
+	return s.delegate.query(func(d *delegate) bool {
+		return d.all(false, conditions)
+	})
+}
+
+// AnyOpened reports whether any of the specified conditions is in the open state.
+// It returns false if no conditions are given.
+// The conditions are read at a single point in time. This method is safe for concurrent use.
+func (s *S) AnyOpened(conditions ...uint) bool {
+	return s.delegate.query(func(d *delegate) bool {
+		return d.any(false, conditions)
+	})
+}
+
+// Closed returns the conditions that are in the closed state, in ascending order.
+// This method is safe for concurrent use.
+func (s *S) Closed() []uint {
+	return s.delegate.indices(registerClosedIndices)
+}
+
+// Opened returns the conditions that are in the open state, in ascending order.
+// With WithDynamicRegister, only the conditions of pages that have been added
+// are returned.
 // This method is safe for concurrent use.
-func (s *S) Toggle(ctx context.Context, conditions ...uint) {
-	s.delegate.toggle(ctx, conditions...)
+func (s *S) Opened() []uint {
+	return s.delegate.indices(registerOpenedIndices)
 }
 
 // GoString returns a string representation of the state machine's current state.
+// Every word of the register is printed in binary, followed by the state of
+// every name defined with Define.
 // This implements the fmt.GoStringer interface.
 func (s *S) GoString() string {
 	return s.delegate.stringVal()
 }
+
+// String returns a human-readable representation of the state machine's
+// current state: one line per name defined with Define, with its state,
+// followed by one line per closed condition that has no name.
+// This implements the fmt.Stringer interface.
+//
+// Example output:
+//
+//	db.connected: closed
+//	cache.ready: open
+//	17: closed
+func (s *S) String() string {
+	return s.delegate.humanVal()
+}
@@ -0,0 +1,447 @@
+package switchboard
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestQueries(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("single and multiple", func(t *testing.T) {
+		t.Parallel()
+
+		var s Switch = New()
+		s.Close(ctx, 1, 2, 3)
+
+		if !s.IsClosed(1) || s.IsOpened(1) || s.IsClosed(4) || !s.IsOpened(4) {
+			t.Fatal("unexpected single state")
+		}
+		if !s.AllClosed(1, 2, 3) || s.AllClosed(1, 4) || !s.AllClosed() {
+			t.Fatal("unexpected AllClosed")
+		}
+		if !s.AnyClosed(4, 3) || s.AnyClosed(4, 5) || s.AnyClosed() {
+			t.Fatal("unexpected AnyClosed")
+		}
+		if !s.AllOpened(4, 5) || s.AllOpened(3, 4) || !s.AllOpened() {
+			t.Fatal("unexpected AllOpened")
+		}
+		if !s.AnyOpened(3, 4) || s.AnyOpened(1, 2) || s.AnyOpened() {
+			t.Fatal("unexpected AnyOpened")
+		}
+	})
+
+	t.Run("enumeration", func(t *testing.T) {
+		t.Parallel()
+
+		s := New(WithAllStatesClosed())
+		s.Open(ctx, 4095, 7, 64)
+
+		if got, want := s.Opened(), []uint{7, 64, 4095}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Opened() = %v, want %v", got, want)
+		}
+		if got := s.Closed(); len(got) != maxReg-3 || got[0] != 0 || got[len(got)-1] != 4094 {
+			t.Fatalf("Closed() returned %d indices", len(got))
+		}
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		t.Parallel()
+
+		s := New()
+		var wg sync.WaitGroup
+		for i := uint(0); i < 8; i++ {
+			wg.Add(2)
+			go func(i uint) {
+				defer wg.Done()
+				s.Close(ctx, i)
+			}(i)
+			go func(i uint) {
+				defer wg.Done()
+				_ = s.IsClosed(i)
+				_ = s.Closed()
+			}(i)
+		}
+		wg.Wait()
+
+		if got, want := s.Closed(), []uint{0, 1, 2, 3, 4, 5, 6, 7}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Closed() = %v, want %v", got, want)
+		}
+	})
+}
+
+func TestDelivery(t *testing.T) {
+	t.Parallel()
+
+	type delivered struct {
+		idx    uint
+		closed bool
+		seq    uint64
+	}
+	record := func(ch chan<- delivered) Option {
+		return WithDefaultChangeHandler(func(ctx context.Context, idx uint, closed bool) {
+			seq, _ := SequenceFromContext(ctx)
+			ch <- delivered{idx, closed, seq}
+		})
+	}
+	collect := func(t *testing.T, ch <-chan delivered, n int) []delivered {
+		t.Helper()
+		out := make([]delivered, 0, n)
+		for len(out) < n {
+			select {
+			case d := <-ch:
+				out = append(out, d)
+			case <-time.After(time.Second):
+				t.Fatalf("expected %d changes, got %v", n, out)
+			}
+		}
+		return out
+	}
+
+	t.Run("ordered", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ch := make(chan delivered, 1000)
+		s := New(record(ch))
+		s.Run(ctx)
+
+		var want []delivered
+		for i := 0; i < 200; i++ {
+			s.Close(ctx, 7)
+			s.Open(ctx, 7)
+			want = append(want, delivered{7, true, uint64(2*i + 1)}, delivered{7, false, uint64(2*i + 2)})
+		}
+		s.Toggle(ctx, 8, 8)
+		want = append(want, delivered{8, true, 401}, delivered{8, false, 402})
+
+		if got := collect(t, ch, len(want)); !reflect.DeepEqual(got, want) {
+			t.Fatalf("changes delivered out of order: %v", got)
+		}
+	})
+
+	t.Run("queued before run", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		ch := make(chan delivered, 10)
+		s := New(record(ch))
+		s.Close(ctx, 1, 2)
+		s.Run(ctx)
+		s.Run(ctx)
+
+		want := []delivered{{1, true, 1}, {2, true, 2}}
+		if got := collect(t, ch, 2); !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	})
+
+	t.Run("backpressure", func(t *testing.T) {
+		t.Parallel()
+
+		tests := []struct {
+			name   string
+			policy BackpressurePolicy
+			want   []delivered
+		}{
+			{"drop newest", DropNewest, []delivered{{0, true, 1}, {1, true, 2}}},
+			{"drop oldest", DropOldest, []delivered{{2, true, 3}, {3, true, 4}}},
+		}
+		for _, tt := range tests {
+			tt := tt
+			t.Run(tt.name, func(t *testing.T) {
+				t.Parallel()
+
+				ctx, cancel := context.WithCancel(context.Background())
+				defer cancel()
+
+				ch := make(chan delivered, 10)
+				s := New(record(ch), WithQueueSize(2), WithBackpressure(tt.policy))
+				s.Close(ctx, 0, 1, 2, 3)
+				s.Run(ctx)
+
+				if got := collect(t, ch, 2); !reflect.DeepEqual(got, tt.want) {
+					t.Fatalf("expected %v, got %v", tt.want, got)
+				}
+				select {
+				case d := <-ch:
+					t.Fatalf("unexpected change %v", d)
+				case <-time.After(20 * time.Millisecond):
+				}
+			})
+		}
+	})
+
+	t.Run("block", func(t *testing.T) {
+		t.Parallel()
+
+		s := New(WithQueueSize(1))
+		s.Close(context.Background(), 0)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		s.Close(ctx, 1)
+
+		if !s.AllClosed(0, 1) {
+			t.Fatal("expected the state to change even though the change was discarded")
+		}
+	})
+
+	t.Run("full queue", func(t *testing.T) {
+		t.Parallel()
+
+		release := make(chan struct{})
+		s := New(WithQueueSize(1), WithDefaultChangeHandler(func(context.Context, uint, bool) {
+			<-release
+		}))
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s.Run(ctx)
+
+		// the first change is being handled and the second fills the queue,
+		// so the next ones wait for room
+		s.Close(context.Background(), 1)
+		s.Close(context.Background(), 2)
+		var wg sync.WaitGroup
+		for i := uint(3); i < 5; i++ {
+			wg.Add(1)
+			go func(i uint) {
+				defer wg.Done()
+				s.Close(context.Background(), i)
+			}(i)
+		}
+
+		time.Sleep(10 * time.Millisecond) // let the waiting changes reach the queue
+
+		queried := make(chan bool)
+		go func() {
+			queried <- s.AllClosed(1, 2)
+		}()
+		select {
+		case closed := <-queried:
+			if !closed {
+				t.Fatal("expected 1 and 2 to be closed")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected queries not to be blocked by a full queue")
+		}
+
+		// shutting down must release the waiting changes
+		cancel()
+		close(release)
+		waited := make(chan struct{})
+		go func() {
+			wg.Wait()
+			close(waited)
+		}()
+		select {
+		case <-waited:
+		case <-time.After(time.Second):
+			t.Fatal("expected waiting changes to be discarded on shutdown")
+		}
+		if !s.AllClosed(3, 4) {
+			t.Fatal("expected the states to change")
+		}
+	})
+
+	t.Run("never run", func(t *testing.T) {
+		t.Parallel()
+
+		ch := make(chan delivered, 4)
+		s := New(WithQueueSize(2), record(ch))
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			for i := uint(0); i < 10; i++ {
+				s.Close(context.Background(), i)
+			}
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("expected changes not to block before Run")
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		s.Run(ctx)
+		if got := collect(t, ch, 2); got[0].idx != 8 || got[1].idx != 9 {
+			t.Fatalf("expected the latest changes, got %+v", got)
+		}
+	})
+
+	t.Run("run after cancel", func(t *testing.T) {
+		t.Parallel()
+
+		for i := uint(0); i < 50; i++ {
+			ch := make(chan delivered, 1)
+			s := New(record(ch))
+			ctx, cancel := context.WithCancel(context.Background())
+			s.Run(ctx)
+			cancel()
+
+			ctx, cancel = context.WithCancel(context.Background())
+			s.Run(ctx)
+			s.Close(context.Background(), i)
+			if got := collect(t, ch, 1); got[0].idx != i || !got[0].closed {
+				t.Fatalf("unexpected change: %+v", got[0])
+			}
+			cancel()
+		}
+	})
+
+	t.Run("shutdown", func(t *testing.T) {
+		t.Parallel()
+
+		s := New(WithQueueSize(1))
+		ctx, cancel := context.WithCancel(context.Background())
+		s.Run(ctx)
+		cancel()
+		s.mu.Lock()
+		exited := s.loop.exited
+		s.mu.Unlock()
+		<-exited
+
+		// without a running loop, changes must neither block nor leave goroutines behind
+		done := make(chan struct{})
+		go func() {
+			defer close(done)
+			s.Close(context.Background(), 1, 2, 3)
+			s.Toggle(context.Background(), 1, 2, 3)
+		}()
+		select {
+		case <-done:
+		case <-time.After(time.Second):
+			t.Fatal("expected changes to be discarded after shutdown")
+		}
+		if !s.AllOpened(1, 2, 3) {
+			t.Fatal("expected the states to change")
+		}
+	})
+}
+
+func TestRegisterSize(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("fixed", func(t *testing.T) {
+		t.Parallel()
+
+		s := New()
+		for _, f := range []func(context.Context, ...uint) error{s.Close, s.Open, s.Toggle} {
+			if err := f(ctx, 1, maxReg); !errors.Is(err, ErrOutOfRange) {
+				t.Fatalf("expected ErrOutOfRange, got %v", err)
+			}
+		}
+		if !s.IsOpened(1) {
+			t.Fatal("expected no state to change")
+		}
+		if err := s.Close(ctx, maxReg-1); err != nil {
+			t.Fatal(err)
+		}
+		if s.IsClosed(maxReg) || !s.IsOpened(maxReg) || s.AnyClosed(maxReg, 1<<40) || !s.AllClosed(maxReg-1) {
+			t.Fatal("expected indices beyond the register to be open")
+		}
+
+		canceled, cancel := context.WithCancel(ctx)
+		cancel()
+		if err := s.Close(canceled, 1); !errors.Is(err, context.Canceled) {
+			t.Fatalf("expected context.Canceled, got %v", err)
+		}
+	})
+
+	t.Run("dynamic", func(t *testing.T) {
+		t.Parallel()
+
+		changes := make(chan uint, 8)
+		s := New(WithDynamicRegister(), WithDefaultChangeHandler(func(_ context.Context, idx uint, _ bool) {
+			changes <- idx
+		}))
+		runCtx, cancel := context.WithCancel(ctx)
+		defer cancel()
+		s.Run(runCtx)
+
+		big := uint(1<<40 + 3)
+		if err := s.Close(ctx, 7, maxReg, big); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.Toggle(ctx, maxReg+1, maxReg); err != nil {
+			t.Fatal(err)
+		}
+		if !s.AllClosed(7, big, maxReg+1) || !s.IsOpened(maxReg) || s.IsClosed(big+1) || !s.AnyOpened(big, maxReg) {
+			t.Fatal("unexpected states")
+		}
+		if got, want := s.Closed(), []uint{7, maxReg + 1, big}; !reflect.DeepEqual(got, want) {
+			t.Fatalf("Closed() = %v, want %v", got, want)
+		}
+		if got := s.Opened(); len(got) != 3*maxReg-3 {
+			t.Fatalf("expected the open indices of 3 pages, got %d", len(got))
+		}
+
+		for _, want := range []uint{7, maxReg, big, maxReg + 1, maxReg} {
+			select {
+			case got := <-changes:
+				if got != want {
+					t.Fatalf("expected change of %d, got %d", want, got)
+				}
+			case <-time.After(time.Second):
+				t.Fatal("timed out waiting for changes")
+			}
+		}
+	})
+
+	t.Run("dynamic all closed", func(t *testing.T) {
+		t.Parallel()
+
+		s := New(WithAllStatesClosed(), WithDynamicRegister())
+		if !s.AllClosed(0, maxReg, 1<<40) {
+			t.Fatal("expected every state to be closed")
+		}
+		if err := s.Open(ctx, maxReg*2); err != nil {
+			t.Fatal(err)
+		}
+		if !s.IsOpened(maxReg*2) || !s.IsClosed(maxReg*2+1) {
+			t.Fatal("expected new pages to start closed")
+		}
+	})
+
+	t.Run("signals and names", func(t *testing.T) {
+		t.Parallel()
+
+		s := New(WithDynamicRegister())
+		sig := s.When(AllClosed(maxReg + 5)).Do(func(context.Context, bool) {})
+		for i := 0; i < maxReg+1; i++ {
+			if _, err := s.Define(strings.Repeat("x", i+1)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		h, err := s.Define("beyond")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if h.Index() != maxReg+1 {
+			t.Fatalf("expected index %d, got %d", maxReg+1, h.Index())
+		}
+		if err := s.Close(ctx, maxReg+5); err != nil {
+			t.Fatal(err)
+		}
+		if !sig.Active() {
+			t.Fatal("expected signal to be active")
+		}
+		if !strings.HasPrefix(s.GoString(), "127  ") {
+			t.Fatal("expected GoString to start with the last word of the second page")
+		}
+	})
+}
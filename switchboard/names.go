@@ -0,0 +1,97 @@
+package switchboard
+
+import (
+	"context"
+	"fmt"
+)
+
+// Handle is a named condition of a switchboard, created with S.Define.
+// It carries the index allocated for the name, so callers never deal with
+// raw indices.
+type Handle struct {
+	s    *S
+	idx  uint
+	name string
+}
+
+// Define allocates the next free index for name and returns a Handle for it.
+// Indices are allocated in ascending order from 0, so names should not be
+// mixed with raw indices chosen by the caller. It returns an error wrapping
+// ErrDuplicateName if the name is already defined, and ErrRegisterFull if
+// every index is in use, which never happens with WithDynamicRegister.
+// This method is safe for concurrent use.
+//
+// Example:
+//
+//	db, err := s.Define("db.connected")
+//	if err != nil {
+//	    // handle error
+//	}
+//	db.Close(ctx)
+func (s *S) Define(name string) (Handle, error) {
+	idx, err := s.delegate.define(name)
+	if err != nil {
+		return Handle{}, err
+	}
+
+	return Handle{s: s, idx: idx, name: name}, nil
+}
+
+// Lookup returns the Handle of a defined name. It returns an error wrapping
+// ErrUndefinedName if the name was never defined.
+// This method is safe for concurrent use.
+func (s *S) Lookup(name string) (Handle, error) {
+	idx, ok := s.delegate.index(name)
+	if !ok {
+		return Handle{}, fmt.Errorf("%w: '%s'", ErrUndefinedName, name)
+	}
+
+	return Handle{s: s, idx: idx, name: name}, nil
+}
+
+// Name returns the name defined for the condition at idx, if any.
+// It can be used in handlers to log names instead of indices.
+// This method is safe for concurrent use.
+func (s *S) Name(idx uint) (string, bool) {
+	return s.delegate.name(idx)
+}
+
+// Index returns the index allocated for the Handle's name.
+func (h Handle) Index() uint {
+	return h.idx
+}
+
+// Name returns the name of the Handle.
+func (h Handle) Name() string {
+	return h.name
+}
+
+// String returns the name of the Handle.
+func (h Handle) String() string {
+	return h.name
+}
+
+// Open sets the condition to the open state. See S.Open.
+func (h Handle) Open(ctx context.Context) error {
+	return h.s.Open(ctx, h.idx)
+}
+
+// Close sets the condition to the closed state. See S.Close.
+func (h Handle) Close(ctx context.Context) error {
+	return h.s.Close(ctx, h.idx)
+}
+
+// Toggle switches the state of the condition. See S.Toggle.
+func (h Handle) Toggle(ctx context.Context) error {
+	return h.s.Toggle(ctx, h.idx)
+}
+
+// IsClosed reports whether the condition is in the closed state.
+func (h Handle) IsClosed() bool {
+	return h.s.IsClosed(h.idx)
+}
+
+// IsOpened reports whether the condition is in the open state.
+func (h Handle) IsOpened() bool {
+	return h.s.IsOpened(h.idx)
+}
@@ -0,0 +1,133 @@
+package switchboard
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestNames(t *testing.T) {
+	t.Parallel()
+
+	ctx := context.Background()
+
+	t.Run("define and lookup", func(t *testing.T) {
+		t.Parallel()
+
+		s := New()
+		db, err := s.Define("db.connected")
+		if err != nil {
+			t.Fatal(err)
+		}
+		cache, err := s.Define("cache.ready")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if db.Index() != 0 || cache.Index() != 1 || db.Name() != "db.connected" {
+			t.Fatalf("unexpected handles: %v=%d, %v=%d", db, db.Index(), cache, cache.Index())
+		}
+
+		if _, err := s.Define("db.connected"); !errors.Is(err, ErrDuplicateName) {
+			t.Fatalf("expected ErrDuplicateName, got %v", err)
+		}
+		if _, err := s.Lookup("queue.drained"); !errors.Is(err, ErrUndefinedName) {
+			t.Fatalf("expected ErrUndefinedName, got %v", err)
+		}
+		h, err := s.Lookup("cache.ready")
+		if err != nil || h != cache {
+			t.Fatalf("unexpected lookup: %v, %v", h, err)
+		}
+
+		if name, ok := s.Name(1); !ok || name != "cache.ready" {
+			t.Fatalf("unexpected name: %q, %v", name, ok)
+		}
+		if _, ok := s.Name(2); ok {
+			t.Fatal("expected no name for index 2")
+		}
+	})
+
+	t.Run("handles", func(t *testing.T) {
+		t.Parallel()
+
+		s := New()
+		db, _ := s.Define("db.connected")
+
+		db.Close(ctx)
+		if !db.IsClosed() || db.IsOpened() || !s.IsClosed(db.Index()) {
+			t.Fatal("expected db.connected to be closed")
+		}
+		db.Toggle(ctx)
+		if !db.IsOpened() {
+			t.Fatal("expected db.connected to be open")
+		}
+		db.Close(ctx)
+		db.Open(ctx)
+		if db.IsClosed() {
+			t.Fatal("expected db.connected to be open")
+		}
+	})
+
+	t.Run("strings", func(t *testing.T) {
+		t.Parallel()
+
+		s := New()
+		db, _ := s.Define("db.connected")
+		_, _ = s.Define("cache.ready")
+		db.Close(ctx)
+		s.Close(ctx, 17)
+
+		want := "db.connected: closed\ncache.ready: open\n17: closed\n"
+		if got := s.String(); got != want {
+			t.Fatalf("String() = %q, want %q", got, want)
+		}
+
+		got := s.GoString()
+		if !strings.HasSuffix(got, "0    db.connected=closed\n1    cache.ready=open\n") {
+			t.Fatalf("GoString() does not list the names:\n%s", got)
+		}
+	})
+
+	t.Run("register full", func(t *testing.T) {
+		t.Parallel()
+
+		s := New()
+		for i := 0; i < maxReg; i++ {
+			if _, err := s.Define(strings.Repeat("x", i+1)); err != nil {
+				t.Fatal(err)
+			}
+		}
+		if _, err := s.Define("one.too.many"); !errors.Is(err, ErrRegisterFull) {
+			t.Fatalf("expected ErrRegisterFull, got %v", err)
+		}
+	})
+
+	t.Run("concurrent", func(t *testing.T) {
+		t.Parallel()
+
+		s := New()
+		var wg sync.WaitGroup
+		handles := make([]Handle, 16)
+		for i := range handles {
+			wg.Add(1)
+			go func(i int) {
+				defer wg.Done()
+				h, err := s.Define(strings.Repeat("n", i+1))
+				if err != nil {
+					t.Error(err)
+				}
+				handles[i] = h
+			}(i)
+		}
+		wg.Wait()
+
+		seen := make(map[uint]bool)
+		for _, h := range handles {
+			if seen[h.Index()] {
+				t.Fatalf("index %d allocated twice", h.Index())
+			}
+			seen[h.Index()] = true
+		}
+	})
+}
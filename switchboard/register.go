@@ -3,6 +3,7 @@ package switchboard
 import (
 	"fmt"
 	"math"
+	"math/bits"
 )
 
 const (
@@ -16,9 +17,9 @@ const (
 
 // offset calculates the word index and bit offset within that word for a given state index.
 // It returns the word index and the bit offset within that word.
-// Panics if the index exceeds maxReg (4096).
+// Panics if the index is not below maxReg (4096).
 func offset(idx uint) (uint, uint) {
-	if idx > maxReg {
+	if idx >= maxReg {
 		panic(fmt.Sprintf("state: overflow - a single state S can hold no more than %d indices", maxReg))
 	}
 
@@ -35,6 +36,17 @@ func shift(offs uint) uint64 {
 // of up to 4096 different conditions using bit manipulation.
 type register [capacity]uint64
 
+// fits reports whether all the indices fit in a single register.
+func fits(indices []uint) bool {
+	for i := 0; i < len(indices); i++ {
+		if indices[i] >= maxReg {
+			return false
+		}
+	}
+
+	return true
+}
+
 // registerWithAllClosed creates a new register with all bits set to 1 (closed state).
 // By default, registers are initialized with all bits set to 0 (open state).
 func registerWithAllClosed() (r register) {
@@ -162,6 +174,30 @@ func registerAnyOpened(r register, indices ...uint) bool {
 	return false
 }
 
+// registerClosedIndices returns the indices that are in the closed state, in ascending order.
+func registerClosedIndices(r register) []uint {
+	var out []uint
+	for i := 0; i < capacity; i++ {
+		for w := r[i]; w != 0; w &= w - 1 {
+			out = append(out, uint(i*wordSize+bits.TrailingZeros64(w)))
+		}
+	}
+
+	return out
+}
+
+// registerOpenedIndices returns the indices that are in the open state, in ascending order.
+func registerOpenedIndices(r register) []uint {
+	var out []uint
+	for i := 0; i < capacity; i++ {
+		for w := ^r[i]; w != 0; w &= w - 1 {
+			out = append(out, uint(i*wordSize+bits.TrailingZeros64(w)))
+		}
+	}
+
+	return out
+}
+
 // registerToggle switches the state of the specified indices.
 // If an index is open, it will be closed, and if it's closed, it will be opened.
 // It returns the modified register, a slice of indices that were closed, and a slice of indices that were opened.
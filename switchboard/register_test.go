@@ -23,7 +23,7 @@ func Test_offset(t *testing.T) {
 		{name: "65", idx: 65, wantIdx: 1, wantOffs: 1},
 		{name: "3000", idx: 3000, wantIdx: 46, wantOffs: 56},
 		{name: "4095", idx: 4095, wantIdx: 63, wantOffs: 63},
-		{name: "4096", idx: 4096, wantIdx: 64, wantOffs: 0},
+		{name: "4096", idx: 4096, wantPanic: true},
 		{name: "4097", idx: 4097, wantPanic: true},
 	}
 	for _, tt := range tests {
@@ -308,3 +308,60 @@ func Test_registerToggle(t *testing.T) {
 		})
 	}
 }
+
+func Test_registerIndices(t *testing.T) {
+	t.Parallel()
+
+	all := make([]uint, maxReg)
+	for i := range all {
+		all[i] = uint(i)
+	}
+
+	tests := []struct {
+		name       string
+		start      register
+		indices    []uint
+		wantClosed []uint
+		wantOpened int
+	}{
+		{
+			name:       "none",
+			wantOpened: maxReg,
+		},
+		{
+			name:       "word boundaries",
+			indices:    []uint{4095, 0, 64, 63, 1000},
+			wantClosed: []uint{0, 63, 64, 1000, 4095},
+			wantOpened: maxReg - 5,
+		},
+		{
+			name:       "all closed",
+			start:      registerWithAllClosed(),
+			wantClosed: all,
+		},
+	}
+	for _, tt := range tests {
+		tt := tt
+		t.Run(tt.name, func(t *testing.T) {
+			t.Parallel()
+
+			r, _ := registerClose(tt.start, tt.indices...)
+			if got := registerClosedIndices(r); !reflect.DeepEqual(got, tt.wantClosed) {
+				t.Errorf("registerClosedIndices() = %v, want %v", got, tt.wantClosed)
+			}
+			opened := registerOpenedIndices(r)
+			if len(opened) != tt.wantOpened {
+				t.Errorf("registerOpenedIndices() returned %d indices, want %d", len(opened), tt.wantOpened)
+			}
+			for _, idx := range opened {
+				if !registerOpened(r, idx) {
+					t.Errorf("registerOpenedIndices() returned closed index %d", idx)
+				}
+			}
+		})
+	}
+
+	if n := len(registerClosedIndices(registerWithAllClosed())); n != maxReg {
+		t.Errorf("registerClosedIndices() returned %d indices, want %d", n, maxReg)
+	}
+}
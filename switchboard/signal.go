@@ -0,0 +1,123 @@
+package switchboard
+
+import (
+	"context"
+)
+
+// Condition is a predicate over the states of a switchboard, used to define
+// derived signals with S.When. Conditions are created with AllClosed,
+// AnyClosed, AllOpened and AnyOpened.
+type Condition struct {
+	eval func(*delegate) bool
+}
+
+// AllClosed creates a Condition that holds when all the specified conditions
+// are in the closed state.
+func AllClosed(conditions ...uint) Condition {
+	return Condition{eval: func(d *delegate) bool {
+		return d.all(true, conditions)
+	}}
+}
+
+// AnyClosed creates a Condition that holds when any of the specified
+// conditions is in the closed state.
+func AnyClosed(conditions ...uint) Condition {
+	return Condition{eval: func(d *delegate) bool {
+		return d.any(true, conditions)
+	}}
+}
+
+// AllOpened creates a Condition that holds when all the specified conditions
+// are in the open state.
+func AllOpened(conditions ...uint) Condition {
+	return Condition{eval: func(d *delegate) bool {
+		return d.all(false, conditions)
+	}}
+}
+
+// AnyOpened creates a Condition that holds when any of the specified
+// conditions is in the open state.
+func AnyOpened(conditions ...uint) Condition {
+	return Condition{eval: func(d *delegate) bool {
+		return d.any(false, conditions)
+	}}
+}
+
+// SignalHandler is a function that handles changes of a derived signal.
+// It receives the context of the change that caused it, and whether the
+// signal became active (true) or inactive (false).
+type SignalHandler func(ctx context.Context, active bool)
+
+// Signal is a derived condition that is active while all of its Conditions
+// hold. It is evaluated after every Open, Close and Toggle, and its handler is
+// only notified when it becomes active or inactive, through the same ordered
+// queue as the changes that caused it.
+type Signal struct {
+	s          *S
+	conditions []Condition
+	handler    SignalHandler
+	active     bool
+}
+
+// When creates a Signal that is active while all the specified conditions hold.
+// The Signal is evaluated once its handler is registered with Do.
+//
+// Example:
+//
+//	ready := s.When(
+//		switchboard.AllClosed(DB, Cache, Auth),
+//		switchboard.AllOpened(Maintenance),
+//	).Do(func(ctx context.Context, active bool) {
+//		log.Println("ready:", active)
+//	})
+func (s *S) When(conditions ...Condition) *Signal {
+	return &Signal{s: s, conditions: conditions}
+}
+
+// Do registers the handler of the Signal and starts evaluating it. The
+// handler is not notified of the initial value of the Signal, which can be
+// read with Active. Calling Do again replaces the handler; calling it with a
+// nil handler does nothing.
+func (sig *Signal) Do(handler SignalHandler) *Signal {
+	if handler == nil {
+		return sig
+	}
+	defer sig.s.delegate.lock().unlock()
+
+	if sig.handler == nil {
+		sig.active = sig.eval(sig.s.delegate)
+		sig.s.delegate.signals = append(sig.s.delegate.signals, sig)
+	}
+	sig.handler = handler
+
+	return sig
+}
+
+// Active reports whether all the conditions of the Signal hold.
+// This method is safe for concurrent use.
+func (sig *Signal) Active() bool {
+	defer sig.s.delegate.lock().unlock()
+
+	return sig.eval(sig.s.delegate)
+}
+
+// eval reports whether all the conditions hold for the states of d.
+// The caller must hold the lock of d.
+func (sig *Signal) eval(d *delegate) bool {
+	for i := 0; i < len(sig.conditions); i++ {
+		if !sig.conditions[i].eval(d) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// notify calls the handler of the Signal.
+func (sig *Signal) notify(ctx context.Context, active bool) {
+	sig.s.delegate.lock()
+	handler := sig.handler
+	sig.s.delegate.unlock()
+
+	handler(ctx, active)
+}
@@ -0,0 +1,141 @@
+package switchboard
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestSignal(t *testing.T) {
+	t.Parallel()
+
+	const (
+		db = iota
+		cache
+		auth
+		maintenance
+	)
+
+	type edge struct {
+		active bool
+		seq    uint64
+	}
+
+	t.Run("edges", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		edges := make(chan edge, 10)
+		s := New()
+		ready := s.When(AllClosed(db, cache, auth), AllOpened(maintenance)).Do(func(ctx context.Context, active bool) {
+			seq, _ := SequenceFromContext(ctx)
+			edges <- edge{active, seq}
+		})
+		s.Run(ctx)
+
+		if ready.Active() {
+			t.Fatal("expected signal to be inactive")
+		}
+
+		s.Close(ctx, db, cache) // 1, 2
+		s.Close(ctx, auth)      // 3, then signal 4
+		s.Toggle(ctx, cache)    // 5, then signal 6
+		s.Close(ctx, cache)     // 7, then signal 8
+		s.Open(ctx, cache)      // 9, then signal 10
+		s.Close(ctx, maintenance)
+		s.Close(ctx, cache) // still inactive because of maintenance
+
+		want := []edge{{true, 4}, {false, 6}, {true, 8}, {false, 10}}
+		var got []edge
+		for len(got) < len(want) {
+			select {
+			case e := <-edges:
+				got = append(got, e)
+			case <-time.After(time.Second):
+				t.Fatalf("expected %v, got %v", want, got)
+			}
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+		select {
+		case e := <-edges:
+			t.Fatalf("unexpected edge %v", e)
+		case <-time.After(20 * time.Millisecond):
+		}
+	})
+
+	t.Run("any", func(t *testing.T) {
+		t.Parallel()
+
+		s := New(WithAllStatesClosed())
+		degraded := s.When(AnyOpened(db, cache), AnyClosed(auth)).Do(func(context.Context, bool) {})
+		if degraded.Active() {
+			t.Fatal("expected signal to be inactive")
+		}
+		s.Open(context.Background(), cache)
+		if !degraded.Active() {
+			t.Fatal("expected signal to be active")
+		}
+	})
+
+	t.Run("initial value", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		edges := make(chan bool, 10)
+		s := New(WithAllStatesClosed())
+		s.When(AllClosed(db)).Do(func(_ context.Context, active bool) {
+			edges <- active
+		})
+		s.Run(ctx)
+
+		s.Close(ctx, db) // no change, no edge
+		s.Open(ctx, db)
+
+		select {
+		case active := <-edges:
+			if active {
+				t.Fatal("expected the signal to become inactive")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected an edge")
+		}
+	})
+
+	t.Run("nil handler", func(t *testing.T) {
+		t.Parallel()
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		edges := make(chan bool, 10)
+		s := New()
+		sig := s.When(AllClosed(db)).Do(nil)
+		if len(s.delegate.signals) != 0 {
+			t.Fatal("expected a nil handler not to register the signal")
+		}
+		sig.Do(func(_ context.Context, active bool) {
+			edges <- active
+		}).Do(nil)
+		if len(s.delegate.signals) != 1 {
+			t.Fatalf("expected the signal to be registered once, got %d", len(s.delegate.signals))
+		}
+		s.Run(ctx)
+
+		s.Close(ctx, db)
+		select {
+		case active := <-edges:
+			if !active {
+				t.Fatal("expected the signal to become active")
+			}
+		case <-time.After(time.Second):
+			t.Fatal("expected an edge")
+		}
+	})
+}